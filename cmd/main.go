@@ -4,8 +4,9 @@ package main
 
 import (
 	"flag"
-	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
 	"github.com/coderafting/sentiment-analysis/internal/service"
+	"net/http"
 	"runtime"
 )
 
@@ -16,6 +17,8 @@ func main() {
 	flag.Parse()
 	runtime.GOMAXPROCS(*maxProcs)
 	a := service.GetApp()
-	fmt.Println("Starting server on port", a.Cf.Port)
-	a.StartServer()
+	logging.Info("Starting server", logging.Fields{"port": a.Cf.Port})
+	if err := a.StartServer(); err != nil && err != http.ErrServerClosed {
+		logging.Fatal("Error while serving", logging.Fields{"error": err})
+	}
 }
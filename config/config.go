@@ -3,28 +3,253 @@ package config
 
 import (
 	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
-	"log"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// mux serializes the access to viper, whose config file is read by GetConfig, by ReloadConfig,
+// and on every change watched by WatchConfig, from different goroutines.
+var mux sync.Mutex
+
 // Config exposes app initialization configuration.
 type Config struct {
 	Port            string
 	Partitions      int
 	PartitionBuffer int
+	// Datastore selects the DataStore implementation: "memory" (default) or "file".
+	Datastore string
+	// DataDir is the directory in which the "file" datastore persists its data.
+	DataDir string
+	// CompactionInterval is the interval at which the "file" datastore compacts its log.
+	CompactionInterval time.Duration
+	// ShutdownTimeout is the deadline for draining the http server and the pipeline on shutdown.
+	ShutdownTimeout time.Duration
+	// AdmissionPolicy specifies how POST /text behaves when the pipeline is saturated:
+	// "block", "reject", or "drop-oldest".
+	AdmissionPolicy string
+	// AdmissionTimeout is the time a text waits for space in the pipeline, before it is rejected,
+	// or before the oldest text is dropped.
+	AdmissionTimeout time.Duration
+	// RetryAfter is the delay suggested to the clients through the Retry-After header, when a text is rejected.
+	RetryAfter time.Duration
+	// BatchMaxItems is the maximum number of texts accepted by a single POST /texts/batch request.
+	BatchMaxItems int
+	// DefaultBucket is the bucket width of the sentiment time-series, when a request doesn't specify one:
+	// "minute", "hour", or "day".
+	DefaultBucket string
+	// Classifier is the name of the classifier that validates and categorizes the texts, "panas" by default.
+	Classifier string
+	// Lexicons are the paths of the lexicon files (JSON or YAML) whose sentiment states are merged with the built-in states.
+	Lexicons []string
+	// Modifiers configures the negation and intensifier pass of the classifier.
+	Modifiers ModifiersConfig
+	// Languages are the languages detected in the texts: "en", "es", or "pt". The first one is the fallback
+	// of the texts without letters.
+	Languages []string
+	// LanguageLexicons maps the languages other than English to the paths of their lexicon files,
+	// the Lexicons field holds the English ones.
+	LanguageLexicons map[string][]string
+	// StreamInterval is the interval at which the sentiment changes are pushed to the clients of the stream,
+	// coalesced per category. A zero interval pushes every change as soon as it happens.
+	StreamInterval time.Duration
+	// FeedBuffer is the number of texts buffered for a client of the texts feed, the texts that don't fit
+	// are dropped for that client.
+	FeedBuffer int
+	// FeedOrigins are the origins, e.g. "https://moderation.example.com", of the pages allowed to open the texts feed
+	// besides the pages served by the host of the service.
+	FeedOrigins []string
+	// ReadinessSaturation is the fraction of its capacity above which a partition makes the service not ready.
+	ReadinessSaturation float64
+	// LogLevel is the minimum level of the log entries: "debug", "info", "warn" or "error".
+	LogLevel string
+	// SplitCategories splits the weight of a text across its categories, so that a text weighs 1 in total
+	// however many categories it has.
+	SplitCategories bool
+	// AuthorWeights maps the authors to the factors by which the weights of their texts are multiplied, e.g. 0.1
+	// to down-weight a prolific author, or 0 to ignore one. The authors are case-insensitive, as the config keys are.
+	AuthorWeights map[string]float64
+	// Baseline is the baseline window that is frozen on startup. It is ignored if it is the zero value.
+	Baseline BaselineConfig
+	// AdminToken is the bearer token required by the admin endpoints, e.g. POST /admin/reload.
+	// The admin endpoints are disabled if it is empty. It is read from the ADMIN_TOKEN environment variable if set.
+	AdminToken string
+}
+
+// ModifiersConfig specifies the negators and the boosters that modify the sentiment states following them.
+// The zero values, e.g. nil Negators or Boosters, indicate the defaults of the classifier.
+type ModifiersConfig struct {
+	// Negation specifies how a negated state is handled: "none", "suppress", "flip", or "weight".
+	Negation string
+	Negators []string
+	// Boosters maps the boosters to the factors by which they multiply the weight of a state.
+	Boosters map[string]float64
+	// Scope is the number of words after a negator or a booster within which a state is modified.
+	Scope int
+	// NegatedWeight is the weight of a negated state, for the "weight" negation.
+	NegatedWeight float64
+}
+
+// BaselineConfig specifies a baseline window, either as the first FirstDays days of the history,
+// or as an explicit From-To range.
+type BaselineConfig struct {
+	FirstDays int
+	From      time.Time
+	To        time.Time
 }
 
 func defaultConfig() {
 	viper.SetConfigName("config_file")
 	viper.AddConfigPath(".")
+	viper.SetDefault("datastore", "memory")
+	viper.SetDefault("dataDir", "data")
+	viper.SetDefault("compactionInterval", "5m")
+	viper.SetDefault("shutdownTimeout", "30s")
+	viper.SetDefault("admissionPolicy", "block")
+	viper.SetDefault("admissionTimeout", "100ms")
+	viper.SetDefault("retryAfter", "1s")
+	viper.SetDefault("batchMaxItems", 10000)
+	viper.SetDefault("defaultBucket", "hour")
+	viper.SetDefault("classifier", "panas")
+	viper.SetDefault("modifiers.negation", "suppress")
+	viper.SetDefault("modifiers.scope", 3)
+	viper.SetDefault("modifiers.negatedWeight", 0.5)
+	viper.SetDefault("languages", []string{"en", "es", "pt"})
+	viper.SetDefault("streamInterval", "0s")
+	viper.SetDefault("feedBuffer", 100)
+	viper.SetDefault("readinessSaturation", 0.9)
+	viper.SetDefault("logLevel", "info")
+	viper.BindEnv("adminToken", "ADMIN_TOKEN")
 	err := viper.ReadInConfig()
 	if err != nil {
-		log.Fatal(fmt.Errorf("fatal error config file: %v,", err))
+		logging.Fatal("Error while reading the config file", logging.Fields{"error": err})
 	}
 }
 
 // GetConfig reads the config file and instantiates the Config data.
 func GetConfig() Config {
+	mux.Lock()
+	defer mux.Unlock()
 	defaultConfig()
-	return Config{Port: viper.GetString("port"), Partitions: viper.GetInt("partitions"), PartitionBuffer: viper.GetInt("partitionBuffer")}
+	return readConfig()
+}
+
+// ReloadConfig re-reads the config file, which must have been read by GetConfig, and instantiates the Config data.
+func ReloadConfig() (Config, error) {
+	mux.Lock()
+	defer mux.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		return Config{}, fmt.Errorf("failed to read the config file: %v", err)
+	}
+	return readConfig(), nil
+}
+
+// WatchConfig watches the config file, which must have been read by GetConfig, and calls onChange whenever
+// the file changes. onChange is expected to re-read the file with ReloadConfig; the file is not read by the watcher,
+// so that every read of the config file is serialized by ReloadConfig.
+func WatchConfig(onChange func()) error {
+	mux.Lock()
+	file := filepath.Clean(viper.ConfigFileUsed())
+	mux.Unlock()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// The directory is watched, rather than the file, so that the file can be replaced, e.g. by an editor.
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(e.Name) == file && e.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					onChange()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logging.Warn("Error while watching the config file", logging.Fields{"error": err})
+			}
+		}
+	}()
+	return nil
+}
+
+func readConfig() Config {
+	return Config{
+		Port:                viper.GetString("port"),
+		Partitions:          viper.GetInt("partitions"),
+		PartitionBuffer:     viper.GetInt("partitionBuffer"),
+		Datastore:           viper.GetString("datastore"),
+		DataDir:             viper.GetString("dataDir"),
+		CompactionInterval:  viper.GetDuration("compactionInterval"),
+		ShutdownTimeout:     viper.GetDuration("shutdownTimeout"),
+		AdmissionPolicy:     viper.GetString("admissionPolicy"),
+		AdmissionTimeout:    viper.GetDuration("admissionTimeout"),
+		RetryAfter:          viper.GetDuration("retryAfter"),
+		BatchMaxItems:       viper.GetInt("batchMaxItems"),
+		DefaultBucket:       viper.GetString("defaultBucket"),
+		Classifier:          viper.GetString("classifier"),
+		Lexicons:            viper.GetStringSlice("lexicons"),
+		Modifiers:           readModifiers(),
+		Languages:           viper.GetStringSlice("languages"),
+		LanguageLexicons:    readLanguageLexicons(),
+		StreamInterval:      viper.GetDuration("streamInterval"),
+		FeedBuffer:          viper.GetInt("feedBuffer"),
+		FeedOrigins:         viper.GetStringSlice("feedOrigins"),
+		ReadinessSaturation: viper.GetFloat64("readinessSaturation"),
+		LogLevel:            viper.GetString("logLevel"),
+		SplitCategories:     viper.GetBool("splitCategories"),
+		AuthorWeights:       readAuthorWeights(),
+		Baseline: BaselineConfig{
+			FirstDays: viper.GetInt("baseline.firstDays"),
+			From:      viper.GetTime("baseline.from"),
+			To:        viper.GetTime("baseline.to"),
+		},
+		AdminToken: viper.GetString("adminToken"),
+	}
+}
+
+func readModifiers() ModifiersConfig {
+	m := ModifiersConfig{
+		Negation:      viper.GetString("modifiers.negation"),
+		Scope:         viper.GetInt("modifiers.scope"),
+		NegatedWeight: viper.GetFloat64("modifiers.negatedWeight"),
+	}
+	if viper.IsSet("modifiers.negators") {
+		m.Negators = append([]string{}, viper.GetStringSlice("modifiers.negators")...)
+	}
+	if viper.IsSet("modifiers.boosters") {
+		m.Boosters = map[string]float64{}
+		for b, f := range viper.GetStringMap("modifiers.boosters") {
+			m.Boosters[b] = cast.ToFloat64(f)
+		}
+	}
+	return m
+}
+
+func readAuthorWeights() map[string]float64 {
+	weights := map[string]float64{}
+	for author, f := range viper.GetStringMap("authorWeights") {
+		weights[author] = cast.ToFloat64(f)
+	}
+	return weights
+}
+
+func readLanguageLexicons() map[string][]string {
+	lexicons := map[string][]string{}
+	for lang := range viper.GetStringMap("languageLexicons") {
+		lexicons[lang] = viper.GetStringSlice("languageLexicons." + lang)
+	}
+	return lexicons
 }
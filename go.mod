@@ -2,11 +2,17 @@ module github.com/coderafting/sentiment-analysis
 
 require (
 	github.com/coderafting/panas-go v1.0.4
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/google/uuid v1.1.2
+	github.com/prometheus/client_golang v1.12.2
+	github.com/prometheus/client_model v0.2.0
+	github.com/spf13/cast v1.3.0
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.6.1
 	github.com/unrolled/render v1.0.3
+	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 go 1.14
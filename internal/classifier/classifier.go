@@ -0,0 +1,272 @@
+// Package classifier exposes a Classifier interface, which decides whether a text can be considered
+// for the sentiment analysis, and detects its sentiment categories.
+// The default implementation, Panas, is based on the PANAS-t paper, via the panas-go package.
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coderafting/panas-go/pkg/sentiment"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownClassifier is returned when no classifier is registered with the supplied name.
+var ErrUnknownClassifier = errors.New("unknown classifier")
+
+// ErrUnknownCategory is returned when a category is not one of the categories of a classifier.
+var ErrUnknownCategory = errors.New("unknown category")
+
+// DefaultName is the name of the default classifier, Panas.
+const DefaultName = "panas"
+
+// Match is a sentiment category detected in a text.
+// Weight is the contribution of the match, a zero Weight indicates an unweighted match, i.e. a weight of 1.
+type Match struct {
+	Category string
+	Weight   float64
+}
+
+// Classifier is a text classifier interface that can be implemented by different kinds of classification schemes.
+type Classifier interface {
+	// Validate checks if the text can be considered for the sentiment analysis.
+	Validate(txt string) bool
+	// Categorize returns the sentiment categories detected in the text, a category can be matched more than once.
+	Categorize(txt string) []Match
+	// Categories returns the sentiment categories that Categorize can detect, sorted.
+	Categories() []string
+}
+
+// HasCategory checks if the category is one of the categories of the classifier.
+func HasCategory(clf Classifier, catg string) bool {
+	for _, c := range clf.Categories() {
+		if c == catg {
+			return true
+		}
+	}
+	return false
+}
+
+// Options holds the settings that a registered classifier is instantiated with.
+type Options struct {
+	// Lexicon holds the custom sentiment states, in addition to the built-in states.
+	Lexicon Lexicon
+	// Modifiers holds the negators and the boosters that modify the matches.
+	Modifiers Modifiers
+	// Lang is the language of the texts, English if empty.
+	Lang string
+}
+
+// Panas is a Classifier based on the PANAS-t paper.
+// The states of the Lexicon are matched exactly, and take precedence over the built-in states, which are matched
+// by their Soundex codes, and over the built-in emoji. The negators and the boosters of the Modifiers are not matched
+// as states, they modify the match of the state that follows them.
+// Lang is the language of the texts, English if empty. The texts of a language other than English are validated
+// and categorized by the built-in self references and states of the language, which are matched exactly.
+type Panas struct {
+	Lexicon   Lexicon
+	Modifiers Modifiers
+	Lang      string
+}
+
+// Validate is exposed by Classifier interface. Panas implements this method.
+// A text is valid if it contains a self reference and a sentiment state, either built-in or from the Lexicon.
+// The emoji and the emoticons are sentiment states as well.
+func (p Panas) Validate(txt string) bool {
+	selfRefs, hasState := p.validity(p.Lexicon.tokens(txt))
+	return len(selfRefs) > 0 && hasState
+}
+
+// validity returns the self references among the tokens, and whether the tokens contain a sentiment state.
+func (p Panas) validity(tokens []string) ([]string, bool) {
+	selfRefs := []string{}
+	words := []string{}
+	hasEmoji := false
+	lang, builtIn := languages[p.Lang]
+	for _, t := range tokens {
+		if !isWord(t) {
+			hasEmoji = hasEmoji || len(DefaultEmoji[t]) > 0
+			continue
+		}
+		words = append(words, t)
+		if (builtIn && lang.selfRefs[t]) || (!builtIn && sentiment.ContainsOneSelfRef([]string{t})) {
+			selfRefs = append(selfRefs, t)
+		}
+	}
+	if builtIn {
+		return selfRefs, hasEmoji || lang.states.contains(tokens) || p.Lexicon.contains(tokens)
+	}
+	return selfRefs, hasEmoji || sentiment.ContainsValidSentiment(words) || p.Lexicon.contains(tokens)
+}
+
+// Categorize is exposed by Classifier interface. Panas implements this method.
+func (p Panas) Categorize(txt string) []Match {
+	matches := []Match{}
+	for _, sm := range p.states(p.Lexicon.tokens(txt)) {
+		matches = append(matches, sm.Matches...)
+	}
+	return matches
+}
+
+// Categories is exposed by Classifier interface. Panas implements this method.
+// The categories are the ones recognized by the PANAS-t paper, in every language.
+func (p Panas) Categories() []string {
+	catgs := []string{}
+	for c := range sentiment.CategoriesMap {
+		catgs = append(catgs, c)
+	}
+	sort.Strings(catgs)
+	return catgs
+}
+
+// states returns the sentiment states matched among the tokens, in their order, along with their modified matches.
+func (p Panas) states(tokens []string) []StateMatch {
+	states := []StateMatch{}
+	state := modifierState{}
+	for i := 0; i < len(tokens); {
+		if p.Modifiers.isModifier(tokens[i]) {
+			state = p.Modifiers.see(state, tokens[i])
+			i++
+			continue
+		}
+		catgs, n := p.Lexicon.match(tokens, i)
+		source := builtInSource
+		if n > 0 {
+			source = p.Lexicon.sources[strings.Join(tokens[i:i+n], " ")]
+		} else {
+			catgs, n = p.builtInMatch(tokens, i)
+		}
+		if len(catgs) == 0 {
+			state = state.skip(n)
+		} else {
+			states = append(states, StateMatch{
+				State:      strings.Join(tokens[i:i+n], " "),
+				Source:     source,
+				Categories: catgs,
+				Modifiers:  state.words(),
+				Matches:    p.Modifiers.apply(state, catgs),
+			})
+			state = modifierState{}
+		}
+		i += n
+	}
+	return states
+}
+
+// builtInMatch returns the categories of the built-in state or emoji that starts at the i-th token,
+// and the number of its tokens, which is at least 1.
+func (p Panas) builtInMatch(tokens []string, i int) ([]string, int) {
+	if !isWord(tokens[i]) {
+		return DefaultEmoji[tokens[i]], 1
+	}
+	lang, ok := languages[p.Lang]
+	if !ok {
+		return sentiment.Categories(tokens[i]), 1
+	}
+	if catgs, n := lang.states.match(tokens, i); n > 0 {
+		return catgs, n
+	}
+	return nil, 1
+}
+
+// LanguageClassifier is a Classifier that holds a Classifier per language.
+type LanguageClassifier interface {
+	Classifier
+	// Language returns the Classifier of the language.
+	Language(lang string) Classifier
+}
+
+// Multilingual is a LanguageClassifier. The texts of a language without a Classifier are handled
+// by the Classifier of the Default language, which is also used by Validate and Categorize.
+type Multilingual struct {
+	Default     string
+	Classifiers map[string]Classifier
+}
+
+// Language is exposed by LanguageClassifier interface. Multilingual implements this method.
+func (m Multilingual) Language(lang string) Classifier {
+	if clf, ok := m.Classifiers[lang]; ok {
+		return clf
+	}
+	return m.Classifiers[m.Default]
+}
+
+// Validate is exposed by Classifier interface. Multilingual implements this method.
+func (m Multilingual) Validate(txt string) bool {
+	return m.Language(m.Default).Validate(txt)
+}
+
+// Categorize is exposed by Classifier interface. Multilingual implements this method.
+func (m Multilingual) Categorize(txt string) []Match {
+	return m.Language(m.Default).Categorize(txt)
+}
+
+// Categories is exposed by Classifier interface. Multilingual implements this method.
+// The categories are the ones of the Classifiers of all the languages.
+func (m Multilingual) Categories() []string {
+	seen := map[string]bool{}
+	catgs := []string{}
+	for _, clf := range m.Classifiers {
+		for _, c := range clf.Categories() {
+			if !seen[c] {
+				seen[c] = true
+				catgs = append(catgs, c)
+			}
+		}
+	}
+	sort.Strings(catgs)
+	return catgs
+}
+
+// ForLanguage returns the Classifier of the language if clf is a LanguageClassifier, and clf otherwise.
+func ForLanguage(clf Classifier, lang string) Classifier {
+	if lc, ok := clf.(LanguageClassifier); ok {
+		return lc.Language(lang)
+	}
+	return clf
+}
+
+var (
+	registryMux sync.RWMutex
+	registry    = map[string]func(opts Options) Classifier{
+		DefaultName: func(opts Options) Classifier {
+			return Panas{Lexicon: opts.Lexicon, Modifiers: opts.Modifiers, Lang: opts.Lang}
+		},
+	}
+)
+
+// Register makes a classifier available by the supplied name, e.g. to be selected in the config.
+// It replaces the classifier that is registered by the same name, if any.
+func Register(name string, newClassifier func(opts Options) Classifier) {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+	registry[name] = newClassifier
+}
+
+// Names returns the names of the registered classifiers, sorted.
+func Names() []string {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetClassifier instantiates the classifier registered by the supplied name, with the supplied options.
+// An empty name indicates the default classifier.
+func GetClassifier(name string, opts Options) (Classifier, error) {
+	if name == "" {
+		name = DefaultName
+	}
+	registryMux.RLock()
+	newClassifier, ok := registry[name]
+	registryMux.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Classifier %v is not one of %v: %w", name, Names(), ErrUnknownClassifier)
+	}
+	return newClassifier(opts), nil
+}
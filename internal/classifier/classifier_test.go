@@ -0,0 +1,172 @@
+package classifier
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// keyword is a Classifier that validates every text, and matches a single keyword.
+type keyword struct{}
+
+func (keyword) Validate(txt string) bool {
+	return true
+}
+
+func (keyword) Categorize(txt string) []Match {
+	if txt == "yay" {
+		return []Match{Match{Category: "jovility", Weight: 2}}
+	}
+	return []Match{}
+}
+
+func (keyword) Categories() []string {
+	return []string{"jovility"}
+}
+
+func TestPanas(t *testing.T) {
+	clf := Panas{}
+	if !clf.Validate("I feel happy") || clf.Validate("It is a happy day") {
+		t.Errorf("Validate failed for the PANAS-t patterns")
+	}
+	expected := []Match{Match{Category: "jovility", Weight: 1}}
+	if out := clf.Categorize("I feel happy"); !reflect.DeepEqual(out, expected) {
+		t.Errorf("Categorize failed, expected %v, got %v", expected, out)
+	}
+	if !HasCategory(clf, "jovility") || HasCategory(clf, "boredom") || len(clf.Categories()) != 11 {
+		t.Errorf("Categories failed, got %v", clf.Categories())
+	}
+}
+
+func TestGetClassifier(t *testing.T) {
+	Register("keyword", func(opts Options) Classifier { return keyword{} })
+	type testCase struct {
+		name     string
+		expected Classifier
+	}
+	cases := []testCase{
+		testCase{name: "", expected: Panas{}},
+		testCase{name: "panas", expected: Panas{}},
+		testCase{name: "keyword", expected: keyword{}},
+	}
+	for _, c := range cases {
+		clf, err := GetClassifier(c.name, Options{})
+		if err != nil || !reflect.DeepEqual(clf, c.expected) {
+			t.Errorf("GetClassifier failed for %q, expected %v, got %v, %v", c.name, c.expected, clf, err)
+		}
+	}
+	if _, err := GetClassifier("vader", Options{}); !errors.Is(err, ErrUnknownClassifier) {
+		t.Errorf("GetClassifier failed, expected %v, got %v", ErrUnknownClassifier, err)
+	}
+}
+
+func TestPanasLanguages(t *testing.T) {
+	esMods, err := NewModifiers(Suppress, LanguageNegators["es"], LanguageBoosters["es"], DefaultScope, DefaultNegatedWeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptMods, err := NewModifiers(Flip, LanguageNegators["pt"], LanguageBoosters["pt"], DefaultScope, DefaultNegatedWeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clf := Multilingual{Default: "en", Classifiers: map[string]Classifier{
+		"en": Panas{},
+		"es": Panas{Modifiers: esMods, Lang: "es"},
+		"pt": Panas{Modifiers: ptMods, Lang: "pt"},
+	}}
+	type testCase struct {
+		lang     string
+		txt      string
+		valid    bool
+		expected []Match
+	}
+	cases := []testCase{
+		testCase{lang: "es", txt: "Estoy muy feliz hoy", valid: true, expected: []Match{Match{Category: "jovility", Weight: 1.5}}},
+		testCase{lang: "es", txt: "Me siento en paz y con sueño", valid: true,
+			expected: []Match{Match{Category: "serenity", Weight: 1}, Match{Category: "fatigue", Weight: 1}}},
+		testCase{lang: "es", txt: "No estoy tímida", valid: true, expected: []Match{}},
+		testCase{lang: "es", txt: "El día está feliz", valid: false, expected: []Match{Match{Category: "jovility", Weight: 1}}},
+		testCase{lang: "pt", txt: "Eu não estou feliz", valid: true, expected: []Match{Match{Category: "sadness", Weight: 1}}},
+		testCase{lang: "pt", txt: "Estou com medo 😱", valid: true,
+			expected: []Match{Match{Category: "fear", Weight: 1}, Match{Category: "fear", Weight: 1}}},
+		testCase{lang: "pt", txt: "I feel happy", valid: false, expected: []Match{}},
+		testCase{lang: "fr", txt: "I feel happy", valid: true, expected: []Match{Match{Category: "jovility", Weight: 1}}},
+	}
+	for _, c := range cases {
+		lc := ForLanguage(clf, c.lang)
+		if valid := lc.Validate(c.txt); valid != c.valid {
+			t.Errorf("Validate failed for %q in %v, expected %v, got %v", c.txt, c.lang, c.valid, valid)
+		}
+		if out := lc.Categorize(c.txt); !reflect.DeepEqual(out, c.expected) {
+			t.Errorf("Categorize failed for %q in %v, expected %v, got %v", c.txt, c.lang, c.expected, out)
+		}
+	}
+	mixed := Multilingual{Default: "en", Classifiers: map[string]Classifier{"en": keyword{}, "es": Panas{Lang: "es"}}}
+	if catgs := mixed.Categories(); !reflect.DeepEqual(catgs, Panas{}.Categories()) {
+		t.Errorf("Categories failed, expected the categories of all the languages, got %v", catgs)
+	}
+	if !reflect.DeepEqual(ForLanguage(Panas{}, "es"), Panas{}) {
+		t.Errorf("ForLanguage failed, expected the Classifier itself")
+	}
+	if _, conflicts, err := LoadLanguageLexicon("es", "testdata/spanish.yml"); err != nil || len(conflicts) != 1 {
+		t.Errorf("LoadLanguageLexicon failed, expected a conflict with the built-in states, got %v, %v", conflicts, err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	lex, _, err := LoadLexicon("testdata/gaming.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods, err := NewModifiers(Suppress, DefaultNegators, DefaultBoosters, DefaultScope, DefaultNegatedWeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clf := Panas{Lexicon: lex, Modifiers: mods}
+	type testCase struct {
+		txt      string
+		expected Explanation
+	}
+	cases := []testCase{
+		testCase{txt: "I am very hyped 😱", expected: Explanation{
+			Valid:    true,
+			Tokens:   []string{"i", "am", "very", "hyped", "😱"},
+			SelfRefs: []string{"i", "am"},
+			States: []StateMatch{
+				StateMatch{State: "hyped", Source: "testdata/gaming.yml", Categories: []string{"jovility"}, Modifiers: []string{"very"},
+					Matches: []Match{Match{Category: "jovility", Weight: 1.5}}},
+				StateMatch{State: "😱", Source: "built-in", Categories: []string{"fear"}, Modifiers: []string{},
+					Matches: []Match{Match{Category: "fear", Weight: 1}}},
+			},
+			Reasons: []string{},
+		}},
+		testCase{txt: "I am not joyful", expected: Explanation{
+			Valid:    true,
+			Tokens:   []string{"i", "am", "not", "joyful"},
+			SelfRefs: []string{"i", "am"},
+			States: []StateMatch{
+				StateMatch{State: "joyful", Source: "built-in", Categories: []string{"jovility"}, Modifiers: []string{"not"}, Matches: []Match{}},
+			},
+			Reasons: []string{"The text is assigned no category, e.g. its sentiment states are negated, so it would not be stored"},
+		}},
+		testCase{txt: "It is a joyful day", expected: Explanation{
+			Valid:    false,
+			Tokens:   []string{"it", "is", "a", "joyful", "day"},
+			SelfRefs: []string{},
+			States: []StateMatch{
+				StateMatch{State: "joyful", Source: "built-in", Categories: []string{"jovility"}, Modifiers: []string{},
+					Matches: []Match{Match{Category: "jovility", Weight: 1}}},
+			},
+			Reasons: []string{"The text holds no self reference in en"},
+		}},
+	}
+	for _, c := range cases {
+		if out := Explain(clf, c.txt); !reflect.DeepEqual(out, c.expected) {
+			t.Errorf("Explain failed for %q, expected %+v, got %+v", c.txt, c.expected, out)
+		}
+	}
+	out := Explain(keyword{}, "yay")
+	if !out.Valid || len(out.States) != 1 || out.States[0].Matches[0].Weight != 2 {
+		t.Errorf("Explain failed for a Classifier that is not an Explainer, got %+v", out)
+	}
+}
@@ -0,0 +1,119 @@
+package classifier
+
+/*
+emoji offers the built-in emoji and emoticons, mapped to the categories of the PANAS-t paper, and the tokenization
+of the texts into words, emoji and emoticons.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultEmoji maps the built-in emoji and emoticons to their PANAS-t categories.
+// They can be overridden by the emoji of the lexicon files.
+var DefaultEmoji = map[string][]string{
+	// jovility
+	"😀": {"jovility"}, "😃": {"jovility"}, "😄": {"jovility"}, "😁": {"jovility"}, "😆": {"jovility"}, "😊": {"jovility"},
+	"🙂": {"jovility"}, "😂": {"jovility"}, "🤣": {"jovility"}, "😍": {"jovility"}, "🥰": {"jovility"}, "🥳": {"jovility"},
+	"🎉": {"jovility"}, ":)": {"jovility"}, ":-)": {"jovility"}, "=)": {"jovility"}, ":D": {"jovility"}, ":-D": {"jovility"},
+	"xD": {"jovility"}, "XD": {"jovility"}, "^_^": {"jovility"},
+	// selfAssurance
+	"😎": {"selfAssurance"}, "💪": {"selfAssurance"}, "🏆": {"selfAssurance"},
+	// attentiveness
+	"🧐": {"attentiveness"}, "👀": {"attentiveness"},
+	// fear
+	"😱": {"fear"}, "😨": {"fear"}, "😰": {"fear"}, "😧": {"fear"}, "🙀": {"fear"}, "D:": {"fear"},
+	// hostility
+	"😠": {"hostility"}, "😡": {"hostility"}, "🤬": {"hostility"}, "👿": {"hostility"}, "💢": {"hostility"},
+	">:(": {"hostility"}, ">:-(": {"hostility"},
+	// guilt
+	"🤦": {"guilt"}, "🙇": {"guilt"},
+	// sadness
+	"😢": {"sadness"}, "😭": {"sadness"}, "😞": {"sadness"}, "😔": {"sadness"}, "☹": {"sadness"}, "🙁": {"sadness"},
+	"😿": {"sadness"}, "💔": {"sadness"}, ":(": {"sadness"}, ":-(": {"sadness"}, ":'(": {"sadness"}, "=(": {"sadness"},
+	// shyness
+	"😳": {"shyness"}, "🙈": {"shyness"}, "🥺": {"shyness"},
+	// fatigue
+	"😴": {"fatigue"}, "😪": {"fatigue"}, "🥱": {"fatigue"}, "😩": {"fatigue"}, "💤": {"fatigue"}, "-_-": {"fatigue"},
+	// serenity
+	"😌": {"serenity"}, "😇": {"serenity"}, "🧘": {"serenity"}, "☮": {"serenity"},
+	// surprise
+	"😮": {"surprise"}, "😯": {"surprise"}, "😲": {"surprise"}, "🤯": {"surprise"}, ":O": {"surprise"}, ":o": {"surprise"},
+	":-O": {"surprise"}, "o_O": {"surprise"}, "O_o": {"surprise"},
+}
+
+// isEmoji checks if the rune is an emoji, or any other pictographic symbol.
+func isEmoji(r rune) bool {
+	return unicode.Is(unicode.So, r)
+}
+
+// isPresentation checks if the rune only modifies the presentation of an emoji: a variation selector,
+// a skin tone, or a zero width joiner.
+func isPresentation(r rune) bool {
+	return r == '\uFE0E' || r == '\uFE0F' || r == '\u200D' || (r >= 0x1F3FB && r <= 0x1F3FF)
+}
+
+// emojiState normalizes an emoji or an emoticon of a lexicon file. An emoji is a single pictographic symbol,
+// whose presentation is ignored, and an emoticon is a sequence of characters without spaces, e.g. ":)".
+func emojiState(e string) (string, error) {
+	state := strings.Map(func(r rune) rune {
+		if isPresentation(r) {
+			return -1
+		}
+		return r
+	}, e)
+	symbols := 0
+	for _, r := range state {
+		if unicode.IsSpace(r) {
+			return "", fmt.Errorf("Emoji %q holds spaces: %w", e, ErrInvalidLexicon)
+		}
+		if isEmoji(r) {
+			symbols++
+		}
+	}
+	if state == "" || (symbols > 0 && len([]rune(state)) > 1) {
+		return "", fmt.Errorf("Emoji %q is neither a single emoji nor an emoticon: %w", e, ErrInvalidLexicon)
+	}
+	return state, nil
+}
+
+// isEmoticon checks if the text, split by the spaces, is an emoticon of the Lexicon or a built-in emoticon.
+func (lex Lexicon) isEmoticon(s string) bool {
+	if _, ok := lex.states[s]; ok {
+		return true
+	}
+	_, ok := DefaultEmoji[s]
+	return ok
+}
+
+// tokens splits a text into its words, the way validWords does, and its emoji and emoticons, in their order.
+// An emoticon is recognized when it is separated from the words by spaces, or followed by a punctuation mark.
+func (lex Lexicon) tokens(txt string) []string {
+	toks := []string{}
+	for _, chunk := range strings.Split(txt, " ") {
+		if lex.isEmoticon(chunk) {
+			toks = append(toks, chunk)
+			continue
+		}
+		if trimmed := strings.TrimRight(chunk, ".,!?"); trimmed != chunk && lex.isEmoticon(trimmed) {
+			toks = append(toks, trimmed)
+			continue
+		}
+		if word := normalizeWord(chunk); word != "" {
+			toks = append(toks, word)
+		}
+		for _, r := range chunk {
+			if isEmoji(r) {
+				toks = append(toks, string(r))
+			}
+		}
+	}
+	return toks
+}
+
+// isWord checks if the token is a word, rather than an emoji or an emoticon.
+func isWord(token string) bool {
+	return token != "" && !nonAlphanumeric.MatchString(token) && token == strings.ToLower(token)
+}
@@ -0,0 +1,95 @@
+package classifier
+
+/*
+explain offers the explanation of the validation and the categorization of a text, e.g. for a dry run.
+*/
+
+import (
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/language"
+)
+
+// StateMatch is a sentiment state matched in a text.
+type StateMatch struct {
+	// State is the matched state, i.e. its tokens joined by a space.
+	State string
+	// Source is the lexicon file that defines the state, or "built-in".
+	Source     string
+	Categories []string
+	// Modifiers are the negators and the boosters that modify the match of the state.
+	Modifiers []string
+	// Matches are the matches of the state once modified, they are empty if the match is suppressed.
+	Matches []Match
+}
+
+// Explanation details the validation and the categorization of a text.
+type Explanation struct {
+	Valid bool
+	// Tokens are the words, emoji and emoticons of the text, as they are matched.
+	Tokens []string
+	// SelfRefs are the tokens that are self references.
+	SelfRefs []string
+	States   []StateMatch
+	// Reasons explain why the text is not valid, or why it is assigned no category.
+	Reasons []string
+}
+
+// Explainer is implemented by the Classifiers that can explain the validation and the categorization of a text.
+type Explainer interface {
+	Explain(txt string) Explanation
+}
+
+// Explain returns the explanation of the Classifier if it is an Explainer. Otherwise, the explanation holds the outcome
+// of Validate and Categorize only.
+func Explain(clf Classifier, txt string) Explanation {
+	if e, ok := clf.(Explainer); ok {
+		return e.Explain(txt)
+	}
+	exp := Explanation{Valid: clf.Validate(txt), Tokens: []string{}, SelfRefs: []string{}, States: []StateMatch{}, Reasons: []string{}}
+	if matches := clf.Categorize(txt); len(matches) > 0 {
+		exp.States = append(exp.States, StateMatch{Matches: matches})
+	}
+	if !exp.Valid {
+		exp.Reasons = append(exp.Reasons, "The text is not valid as per the classifier")
+	}
+	return exp
+}
+
+// Explain is exposed by Explainer interface. Panas implements this method.
+func (p Panas) Explain(txt string) Explanation {
+	tokens := p.Lexicon.tokens(txt)
+	selfRefs, hasState := p.validity(tokens)
+	exp := Explanation{
+		Valid:    len(selfRefs) > 0 && hasState,
+		Tokens:   tokens,
+		SelfRefs: selfRefs,
+		States:   p.states(tokens),
+		Reasons:  []string{},
+	}
+	lang := p.Lang
+	if lang == "" {
+		lang = language.English
+	}
+	if len(tokens) == 0 {
+		exp.Reasons = append(exp.Reasons, "The text holds no words, emoji, or emoticons")
+	}
+	if len(selfRefs) == 0 {
+		exp.Reasons = append(exp.Reasons, fmt.Sprintf("The text holds no self reference in %v", lang))
+	}
+	if !hasState {
+		exp.Reasons = append(exp.Reasons, fmt.Sprintf("The text holds no sentiment state in %v, either built-in or from the lexicons", lang))
+	}
+	matched := false
+	for _, sm := range exp.States {
+		matched = matched || len(sm.Matches) > 0
+	}
+	if exp.Valid && !matched {
+		exp.Reasons = append(exp.Reasons, "The text is assigned no category, e.g. its sentiment states are negated, so it would not be stored")
+	}
+	return exp
+}
+
+// Explain is exposed by Explainer interface. Multilingual implements this method.
+func (m Multilingual) Explain(txt string) Explanation {
+	return Explain(m.Language(m.Default), txt)
+}
@@ -0,0 +1,113 @@
+package classifier
+
+/*
+languages offers the validity patterns, the sentiment states and the modifiers of the languages other than English,
+for which the panas-go package has no built-in states. The states are the translations of the states of the
+PANAS-t paper, in their masculine and feminine forms.
+*/
+
+import (
+	"github.com/coderafting/sentiment-analysis/internal/language"
+	"sort"
+	"strings"
+)
+
+// builtInLanguage holds the self references and the sentiment states of a language.
+type builtInLanguage struct {
+	selfRefs map[string]bool
+	states   Lexicon
+}
+
+var languages = map[string]builtInLanguage{
+	language.Spanish: newBuiltInLanguage(
+		[]string{"yo", "me", "mi", "estoy", "estaba", "soy", "siento", "sentirme", "sintiendo", "ando", "conmigo"},
+		map[string][]string{
+			"jovility": {"feliz", "felices", "alegre", "contento", "contenta", "encantado", "encantada", "emocionado",
+				"emocionada", "entusiasmado", "entusiasmada", "animado", "animada", "enérgico", "enérgica"},
+			"selfAssurance": {"orgulloso", "orgullosa", "fuerte", "confiado", "confiada", "valiente", "atrevido",
+				"atrevida", "audaz"},
+			"attentiveness": {"alerta", "atento", "atenta", "concentrado", "concentrada", "decidido", "decidida",
+				"determinado", "determinada"},
+			"fear": {"asustado", "asustada", "miedo", "aterrado", "aterrada", "nervioso", "nerviosa", "inquieto",
+				"inquieta", "tembloroso", "temblorosa"},
+			"hostility": {"enojado", "enojada", "enfadado", "enfadada", "furioso", "furiosa", "hostil", "irritable",
+				"irritado", "irritada", "asqueado", "asqueada"},
+			"guilt":   {"culpable", "culpa", "avergonzado", "avergonzada"},
+			"sadness": {"triste", "tristes", "deprimido", "deprimida", "desanimado", "desanimada", "sola", "solitario", "solitaria"},
+			"shyness": {"tímido", "tímida", "vergonzoso", "vergonzosa", "cohibido", "cohibida"},
+			"fatigue": {"cansado", "cansada", "agotado", "agotada", "sueño", "somnoliento", "somnolienta", "exhausto",
+				"exhausta"},
+			"serenity": {"tranquilo", "tranquila", "relajado", "relajada", "calmado", "calmada", "en paz"},
+			"surprise": {"sorprendido", "sorprendida", "asombrado", "asombrada", "impresionado", "impresionada"},
+		},
+	),
+	language.Portuguese: newBuiltInLanguage(
+		[]string{"eu", "me", "mim", "meu", "minha", "estou", "estava", "sou", "sinto", "sentindo", "ando", "comigo"},
+		map[string][]string{
+			"jovility": {"feliz", "felizes", "alegre", "contente", "encantado", "encantada", "empolgado", "empolgada",
+				"entusiasmado", "entusiasmada", "animado", "animada", "enérgico", "enérgica"},
+			"selfAssurance": {"orgulhoso", "orgulhosa", "forte", "confiante", "corajoso", "corajosa", "ousado", "ousada",
+				"destemido", "destemida"},
+			"attentiveness": {"alerta", "atento", "atenta", "concentrado", "concentrada", "determinado", "determinada",
+				"decidido", "decidida"},
+			"fear":      {"assustado", "assustada", "medo", "apavorado", "apavorada", "nervoso", "nervosa", "tenso", "tensa"},
+			"hostility": {"bravo", "brava", "irritado", "irritada", "furioso", "furiosa", "hostil", "raiva"},
+			"guilt":     {"culpado", "culpada", "culpa", "envergonhado", "envergonhada"},
+			"sadness": {"triste", "tristes", "deprimido", "deprimida", "desanimado", "desanimada", "sozinho", "sozinha",
+				"solitário", "solitária"},
+			"shyness":  {"tímido", "tímida", "acanhado", "acanhada"},
+			"fatigue":  {"cansado", "cansada", "exausto", "exausta", "sono", "sonolento", "sonolenta", "esgotado", "esgotada"},
+			"serenity": {"calmo", "calma", "tranquilo", "tranquila", "relaxado", "relaxada", "em paz"},
+			"surprise": {"surpreso", "surpresa", "espantado", "espantada", "impressionado", "impressionada", "chocado",
+				"chocada"},
+		},
+	),
+}
+
+// LanguageNegators are the default negators of every language.
+var LanguageNegators = map[string][]string{
+	language.English:    DefaultNegators,
+	language.Spanish:    {"no", "nunca", "jamás", "tampoco", "ni"},
+	language.Portuguese: {"não", "nunca", "jamais", "nem"},
+}
+
+// LanguageBoosters are the default boosters of every language.
+var LanguageBoosters = map[string]map[string]float64{
+	language.English: DefaultBoosters,
+	language.Spanish: {
+		"muy": 1.5, "tan": 1.5, "super": 1.5, "bastante": 1.5, "demasiado": 1.5,
+		"extremadamente": 2, "increíblemente": 2,
+		"poco": 0.5, "algo": 0.5,
+	},
+	language.Portuguese: {
+		"muito": 1.5, "tão": 1.5, "super": 1.5, "bem": 1.5,
+		"extremamente": 2, "incrivelmente": 2,
+		"pouco": 0.5, "meio": 0.5,
+	},
+}
+
+func newBuiltInLanguage(selfRefs []string, catgStates map[string][]string) builtInLanguage {
+	l := builtInLanguage{selfRefs: map[string]bool{}, states: Lexicon{states: map[string][]string{}, sources: map[string]string{}}}
+	for _, ref := range selfRefs {
+		l.selfRefs[strings.Join(validWords(ref), " ")] = true
+	}
+	states, err := lexiconFile{Categories: catgStates}.states(builtInSource)
+	if err != nil {
+		panic(err)
+	}
+	for state, catgs := range states {
+		l.states.add(state, catgs, builtInSource)
+	}
+	return l
+}
+
+// Languages returns the languages supported by Panas, sorted: English, through the panas-go package,
+// and the languages with built-in states.
+func Languages() []string {
+	langs := []string{language.English}
+	for lang := range languages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
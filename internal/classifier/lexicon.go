@@ -0,0 +1,275 @@
+package classifier
+
+/*
+lexicon offers the custom sentiment states, loaded from lexicon files, which are merged with the built-in
+states of the PANAS-t paper and the built-in emoji.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coderafting/panas-go/pkg/sentiment"
+	"github.com/coderafting/sentiment-analysis/internal/language"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidLexicon is returned when a lexicon file can not be decoded, or maps a state to an unknown category.
+var ErrInvalidLexicon = errors.New("invalid lexicon")
+
+// builtInSource is the source of the states shipped with the PANAS-t paper and of the built-in emoji, in the conflicts.
+const builtInSource = "built-in"
+
+// Lexicon maps the custom sentiment states (words, phrases, emoji or emoticons) to their PANAS-t categories.
+// The zero value is an empty Lexicon.
+type Lexicon struct {
+	// states maps the words of a state, joined by a space, or an emoji, to its categories.
+	states map[string][]string
+	// sources maps a state to the file in which it was defined.
+	sources map[string]string
+	// maxWords is the number of words of the longest state.
+	maxWords int
+}
+
+// lexiconFile is the format of a lexicon file, it maps the sentiment categories to their states, and to their emoji
+// and emoticons. A state can be listed under more than one category.
+type lexiconFile struct {
+	Categories map[string][]string `json:"categories" yaml:"categories"`
+	Emoji      map[string][]string `json:"emoji" yaml:"emoji"`
+}
+
+// Conflict reports a state that is mapped to different categories by two sources, the built-in states
+// of the PANAS-t paper or the lexicon files. The later source takes precedence.
+type Conflict struct {
+	State              string
+	Categories         []string
+	Source             string
+	PreviousCategories []string
+	PreviousSource     string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%q is mapped to %v by %v, replacing %v by %v",
+		c.State, c.Categories, c.Source, c.PreviousCategories, c.PreviousSource)
+}
+
+// LoadLexicon loads the lexicon files, in order, and merges them into a Lexicon.
+// The files are decoded as JSON or YAML, based on their extension. Every category must be one of the categories
+// recognized by the PANAS-t paper. The states that are mapped to different categories by the built-in states and emoji,
+// or by an earlier file, are reported as conflicts, the mapping of the later file takes precedence.
+func LoadLexicon(paths ...string) (Lexicon, []Conflict, error) {
+	return LoadLanguageLexicon(language.English, paths...)
+}
+
+// LoadLanguageLexicon loads the lexicon files of a language, the way LoadLexicon does. The conflicts are reported
+// against the built-in states of the language.
+func LoadLanguageLexicon(lang string, paths ...string) (Lexicon, []Conflict, error) {
+	lex := Lexicon{states: map[string][]string{}, sources: map[string]string{}}
+	conflicts := []Conflict{}
+	for _, path := range paths {
+		lf, err := readLexiconFile(path)
+		if err != nil {
+			return lex, conflicts, err
+		}
+		states, err := lf.states(path)
+		if err != nil {
+			return lex, conflicts, err
+		}
+		for _, state := range sortedKeys(states) {
+			catgs := states[state]
+			if prev, ok := lex.states[state]; ok && !sameCategories(prev, catgs) {
+				conflicts = append(conflicts, Conflict{state, catgs, path, prev, lex.sources[state]})
+			} else if builtIn, ok := builtInCategories(lang, state); ok && !sameCategories(builtIn, catgs) {
+				conflicts = append(conflicts, Conflict{state, catgs, path, builtIn, builtInSource})
+			}
+			lex.add(state, catgs, path)
+		}
+	}
+	return lex, conflicts, nil
+}
+
+// builtInCategories returns the categories of a built-in state of the language or of a built-in emoji,
+// and false if the state is not built-in. The English words are matched by their Soundex code, the way
+// the classifier matches them, so a word that merely sounds like a built-in state is reported as well.
+func builtInCategories(lang string, state string) ([]string, bool) {
+	if l, ok := languages[lang]; ok {
+		if catgs, ok := l.states.states[state]; ok {
+			return catgs, true
+		}
+	} else if isWord(state) {
+		catgs := []string{}
+		for _, c := range sentiment.Categories(state) {
+			if !containsString(catgs, c) {
+				catgs = append(catgs, c)
+			}
+		}
+		if len(catgs) > 0 {
+			sort.Strings(catgs)
+			return catgs, true
+		}
+	}
+	catgs, ok := DefaultEmoji[state]
+	return catgs, ok
+}
+
+func readLexiconFile(path string) (lexiconFile, error) {
+	var lf lexiconFile
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return lf, fmt.Errorf("Failed to read the lexicon %v: %v", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &lf)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &lf)
+	default:
+		return lf, fmt.Errorf("Lexicon %v is neither a JSON nor a YAML file: %w", path, ErrInvalidLexicon)
+	}
+	if err != nil {
+		return lf, fmt.Errorf("Failed to decode the lexicon %v: %v: %w", path, err, ErrInvalidLexicon)
+	}
+	return lf, nil
+}
+
+// states validates the categories of the lexicon file, and maps every normalized state, emoji and emoticon
+// to its categories.
+func (lf lexiconFile) states(path string) (map[string][]string, error) {
+	states := map[string][]string{}
+	add := func(catg string, state string) error {
+		if sentiment.CategoriesMap[catg] != true {
+			return fmt.Errorf("Lexicon %v maps states to the unknown category %v: %w", path, catg, ErrInvalidLexicon)
+		}
+		if !containsString(states[state], catg) {
+			states[state] = append(states[state], catg)
+		}
+		return nil
+	}
+	for catg, catgStates := range lf.Categories {
+		for _, s := range catgStates {
+			state := strings.Join(validWords(s), " ")
+			if state == "" {
+				return states, fmt.Errorf("Lexicon %v maps an empty state to %v: %w", path, catg, ErrInvalidLexicon)
+			}
+			if err := add(catg, state); err != nil {
+				return states, err
+			}
+		}
+	}
+	for catg, catgEmoji := range lf.Emoji {
+		for _, e := range catgEmoji {
+			state, err := emojiState(e)
+			if err != nil {
+				return states, fmt.Errorf("Lexicon %v: %w", path, err)
+			}
+			if err := add(catg, state); err != nil {
+				return states, err
+			}
+		}
+	}
+	for _, catgs := range states {
+		sort.Strings(catgs)
+	}
+	return states, nil
+}
+
+func (lex *Lexicon) add(state string, catgs []string, source string) {
+	lex.states[state] = catgs
+	lex.sources[state] = source
+	if n := len(strings.Split(state, " ")); n > lex.maxWords {
+		lex.maxWords = n
+	}
+}
+
+// Len returns the number of states of the Lexicon.
+func (lex Lexicon) Len() int {
+	return len(lex.states)
+}
+
+// match returns the categories of the longest state that starts at the i-th word, and the number of its words.
+func (lex Lexicon) match(words []string, i int) ([]string, int) {
+	for n := lex.maxWords; n > 0; n-- {
+		if i+n > len(words) {
+			continue
+		}
+		if catgs, ok := lex.states[strings.Join(words[i:i+n], " ")]; ok {
+			return catgs, n
+		}
+	}
+	return nil, 0
+}
+
+// contains checks if at least one state of the Lexicon appears in the tokens.
+func (lex Lexicon) contains(tokens []string) bool {
+	for i := range tokens {
+		if _, n := lex.match(tokens, i); n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var nonAlphanumeric = regexp.MustCompile("[^A-Za-z0-9]+")
+
+// accents folds the accented lowercase letters of the Spanish and Portuguese words, e.g. "não" into "nao",
+// so that they are not stripped as non-alphanumeric characters.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// normalizeWord lowercases a word, folds its accents, and strips its non-alphanumeric characters.
+func normalizeWord(w string) string {
+	return nonAlphanumeric.ReplaceAllString(accents.Replace(strings.ToLower(w)), "")
+}
+
+// validWords splits a text into lowercase alphanumeric words, the way panas-go does, skipping the empty words.
+// Unlike panas-go, the accented letters are folded rather than stripped.
+func validWords(txt string) []string {
+	words := []string{}
+	for _, w := range strings.Split(txt, " ") {
+		if word := normalizeWord(w); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func sameCategories(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, c := range a {
+		if !containsString(b, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(coll []string, s string) bool {
+	for _, c := range coll {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
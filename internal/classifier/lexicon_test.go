@@ -0,0 +1,119 @@
+package classifier
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLoadLexicon(t *testing.T) {
+	lex, conflicts, err := LoadLexicon("testdata/gaming.yml", "testdata/gaming.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lex.Len() != 7 {
+		t.Errorf("Failed: expected 7 states, got %v", lex.Len())
+	}
+	expected := []Conflict{
+		Conflict{State: "happy", Categories: []string{"sadness"}, Source: "testdata/gaming.yml", PreviousCategories: []string{"jovility"}, PreviousSource: "built-in"},
+		Conflict{State: "skared", Categories: []string{"sadness"}, Source: "testdata/gaming.yml", PreviousCategories: []string{"fear"}, PreviousSource: "built-in"},
+		Conflict{State: "tilted", Categories: []string{"fatigue"}, Source: "testdata/gaming.json", PreviousCategories: []string{"hostility"}, PreviousSource: "testdata/gaming.yml"},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Failed: expected conflicts %v, got %v", expected, conflicts)
+	}
+	type testCase struct {
+		path string
+		err  error
+	}
+	cases := []testCase{
+		testCase{path: "testdata/unknown.yml", err: ErrInvalidLexicon},
+		// A plain-text word list is neither JSON nor YAML.
+		testCase{path: "testdata/gaming.txt", err: ErrInvalidLexicon},
+	}
+	for _, c := range cases {
+		if _, _, err := LoadLexicon(c.path); !errors.Is(err, c.err) {
+			t.Errorf("Failed for %v: expected %v, got %v", c.path, c.err, err)
+		}
+	}
+	if _, _, err := LoadLexicon("testdata/missing.yml"); err == nil {
+		t.Errorf("Failed: expected an error for a missing lexicon")
+	}
+}
+
+func TestPanasWithLexicon(t *testing.T) {
+	lex, _, err := LoadLexicon("testdata/gaming.yml", "testdata/gaming.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clf := Panas{Lexicon: lex}
+	type testCase struct {
+		txt        string
+		valid      bool
+		categories []string
+	}
+	cases := []testCase{
+		testCase{txt: "I am hyped!", valid: true, categories: []string{"jovility"}},
+		testCase{txt: "I rage quit, feeling tilted", valid: true, categories: []string{"hostility", "fatigue"}},
+		testCase{txt: "I am happy", valid: true, categories: []string{"sadness"}},
+		testCase{txt: "I am tired", valid: true, categories: []string{"fatigue"}},
+		testCase{txt: "That was clutch", valid: false, categories: []string{"selfAssurance"}},
+	}
+	for _, c := range cases {
+		if valid := clf.Validate(c.txt); valid != c.valid {
+			t.Errorf("Validate failed for %q, expected %v, got %v", c.txt, c.valid, valid)
+		}
+		catgs := []string{}
+		for _, m := range clf.Categorize(c.txt) {
+			catgs = append(catgs, m.Category)
+		}
+		if !reflect.DeepEqual(catgs, c.categories) {
+			t.Errorf("Categorize failed for %q, expected %v, got %v", c.txt, c.categories, catgs)
+		}
+	}
+}
+
+func TestPanasWithEmoji(t *testing.T) {
+	lex, conflicts, err := LoadLexicon("testdata/emoji.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Conflict{
+		Conflict{State: "😂", Categories: []string{"hostility"}, Source: "testdata/emoji.yml", PreviousCategories: []string{"jovility"}, PreviousSource: "built-in"},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Failed: expected conflicts %v, got %v", expected, conflicts)
+	}
+	if _, _, err := LoadLexicon("testdata/invalid_emoji.yml"); !errors.Is(err, ErrInvalidLexicon) {
+		t.Errorf("Failed for testdata/invalid_emoji.yml: expected %v, got %v", ErrInvalidLexicon, err)
+	}
+	type testCase struct {
+		clf        Panas
+		txt        string
+		valid      bool
+		categories []string
+	}
+	cases := []testCase{
+		testCase{clf: Panas{}, txt: "I am 😱", valid: true, categories: []string{"fear"}},
+		testCase{clf: Panas{}, txt: "😱", valid: false, categories: []string{"fear"}},
+		testCase{clf: Panas{}, txt: "Feeling :(", valid: true, categories: []string{"sadness"}},
+		testCase{clf: Panas{}, txt: "I am tired😴😴", valid: true, categories: []string{"fatigue", "fatigue", "fatigue"}},
+		testCase{clf: Panas{}, txt: "I am done -_-.", valid: true, categories: []string{"fatigue"}},
+		testCase{clf: Panas{}, txt: "I am 👍🏽", valid: false, categories: []string{}},
+		testCase{clf: Panas{}, txt: "I am 😂", valid: true, categories: []string{"jovility"}},
+		testCase{clf: Panas{Lexicon: lex}, txt: "I am 😂", valid: true, categories: []string{"hostility"}},
+		testCase{clf: Panas{Lexicon: lex}, txt: "GG, I am 🎮", valid: true, categories: []string{"jovility", "jovility"}},
+	}
+	for _, c := range cases {
+		if valid := c.clf.Validate(c.txt); valid != c.valid {
+			t.Errorf("Validate failed for %q, expected %v, got %v", c.txt, c.valid, valid)
+		}
+		catgs := []string{}
+		for _, m := range c.clf.Categorize(c.txt) {
+			catgs = append(catgs, m.Category)
+		}
+		if !reflect.DeepEqual(catgs, c.categories) {
+			t.Errorf("Categorize failed for %q, expected %v, got %v", c.txt, c.categories, catgs)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package classifier
+
+/*
+modifiers offers the negation and intensifier pass of the categorization: the negators (e.g. "not") and the
+boosters (e.g. "very") that precede a sentiment state modify its match.
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidModifiers is returned when the negation mode, the boosters, or the scope of the modifiers are not valid.
+var ErrInvalidModifiers = errors.New("invalid modifiers")
+
+// NegationMode specifies how the match of a negated state is handled.
+type NegationMode string
+
+const (
+	// NoNegation ignores the negators.
+	NoNegation NegationMode = "none"
+	// Suppress drops the match of a negated state.
+	Suppress NegationMode = "suppress"
+	// Flip replaces the category of a negated state with its opposite category, the match is dropped
+	// if the category has no opposite.
+	Flip NegationMode = "flip"
+	// Weight multiplies the weight of a negated match by the negated weight of the modifiers.
+	Weight NegationMode = "weight"
+)
+
+// DefaultNegators are the negators used when none are configured.
+var DefaultNegators = []string{
+	"not", "no", "never", "nor", "neither", "hardly", "barely",
+	"dont", "doesnt", "didnt", "isnt", "wasnt", "arent", "aint", "cant", "cannot", "wont", "wouldnt",
+}
+
+// DefaultBoosters are the boosters used when none are configured, a factor below 1 weakens a match.
+var DefaultBoosters = map[string]float64{
+	"very": 1.5, "really": 1.5, "so": 1.5, "too": 1.5, "super": 1.5, "totally": 1.5,
+	"extremely": 2, "incredibly": 2,
+	"slightly": 0.5, "somewhat": 0.5, "kinda": 0.5,
+}
+
+// DefaultOpposites maps a category to its opposite category, for the Flip negation mode.
+var DefaultOpposites = map[string]string{
+	"jovility":      "sadness",
+	"sadness":       "jovility",
+	"selfAssurance": "fear",
+	"fear":          "selfAssurance",
+	"attentiveness": "fatigue",
+	"fatigue":       "attentiveness",
+}
+
+const (
+	// DefaultScope is the number of words after a negator or a booster within which a state is modified.
+	DefaultScope = 3
+	// DefaultNegatedWeight is the weight of a negated match, for the Weight negation mode.
+	DefaultNegatedWeight = 0.5
+)
+
+// Modifiers holds the negators and the boosters of the categorization. A negator or a booster modifies the first
+// state within the scope that follows it, the other negators and boosters are not counted in the scope.
+// Two negators cancel each other, and the factors of two boosters are multiplied. The zero value modifies no match.
+type Modifiers struct {
+	negators      map[string]bool
+	boosters      map[string]float64
+	negation      NegationMode
+	scope         int
+	negatedWeight float64
+	opposites     map[string]string
+}
+
+// NewModifiers validates and normalizes the negators and the boosters, which must be single words.
+// The negated weight is used by the Weight negation mode only, it must be between 0 and 1.
+func NewModifiers(negation NegationMode, negators []string, boosters map[string]float64, scope int, negatedWeight float64) (Modifiers, error) {
+	m := Modifiers{negators: map[string]bool{}, boosters: map[string]float64{}, negation: negation,
+		scope: scope, negatedWeight: negatedWeight, opposites: DefaultOpposites}
+	switch negation {
+	case NoNegation, Suppress, Flip:
+	case Weight:
+		if negatedWeight <= 0 || negatedWeight > 1 {
+			return m, fmt.Errorf("The negated weight must be between 0 and 1, got %v: %w", negatedWeight, ErrInvalidModifiers)
+		}
+	default:
+		return m, fmt.Errorf("Negation mode %q is not one of none, suppress, flip, or weight: %w", negation, ErrInvalidModifiers)
+	}
+	if scope <= 0 {
+		return m, fmt.Errorf("The scope must be a positive number of words, got %v: %w", scope, ErrInvalidModifiers)
+	}
+	for _, n := range negators {
+		word, err := modifierWord(n)
+		if err != nil {
+			return m, err
+		}
+		m.negators[word] = true
+	}
+	for b, f := range boosters {
+		word, err := modifierWord(b)
+		if err != nil {
+			return m, err
+		}
+		if f <= 0 {
+			return m, fmt.Errorf("The factor of the booster %q must be positive, got %v: %w", b, f, ErrInvalidModifiers)
+		}
+		m.boosters[word] = f
+	}
+	return m, nil
+}
+
+// modifierWord normalizes a negator or a booster the way the words of a text are normalized.
+func modifierWord(w string) (string, error) {
+	words := validWords(w)
+	if len(words) != 1 {
+		return "", fmt.Errorf("Modifier %q is not a single word: %w", w, ErrInvalidModifiers)
+	}
+	return words[0], nil
+}
+
+// isModifier checks if the word is a negator or a booster, such words are not matched as states.
+func (m Modifiers) isModifier(word string) bool {
+	_, boost := m.boosters[word]
+	return boost || (m.negation != NoNegation && m.negators[word])
+}
+
+// modifierState tracks the negators and the boosters that precede the current word of a text.
+// negators and boosters hold the words that are still within scope, they explain the modified matches.
+type modifierState struct {
+	negated    bool
+	negateLeft int
+	negators   []string
+	boost      float64
+	boostLeft  int
+	boosters   []string
+}
+
+// see updates the state with the word, which is a negator or a booster.
+func (m Modifiers) see(s modifierState, word string) modifierState {
+	if m.negation != NoNegation && m.negators[word] {
+		if s.negateLeft == 0 {
+			s.negators = nil
+		}
+		s.negated = s.negateLeft == 0 || !s.negated
+		s.negateLeft = m.scope
+		s.negators = append(append([]string{}, s.negators...), word)
+	}
+	if f, ok := m.boosters[word]; ok {
+		if s.boostLeft == 0 {
+			s.boost = 1
+			s.boosters = nil
+		}
+		s.boost *= f
+		s.boostLeft = m.scope
+		s.boosters = append(append([]string{}, s.boosters...), word)
+	}
+	return s
+}
+
+// skip updates the state with n words that are neither modifiers nor states.
+func (s modifierState) skip(n int) modifierState {
+	if s.negateLeft -= n; s.negateLeft <= 0 {
+		s.negateLeft, s.negators = 0, nil
+	}
+	if s.boostLeft -= n; s.boostLeft <= 0 {
+		s.boostLeft, s.boosters = 0, nil
+	}
+	return s
+}
+
+// words returns the negators and the boosters that modify the next state.
+func (s modifierState) words() []string {
+	return append(append([]string{}, s.negators...), s.boosters...)
+}
+
+// apply modifies the match of a state with the categories, as per the state. The matches are dropped if the state is
+// negated and the negation mode suppresses them.
+func (m Modifiers) apply(s modifierState, catgs []string) []Match {
+	matches := []Match{}
+	weight := 1.0
+	if s.boostLeft > 0 {
+		weight = s.boost
+	}
+	for _, c := range catgs {
+		if s.negateLeft == 0 || !s.negated {
+			matches = append(matches, Match{Category: c, Weight: weight})
+			continue
+		}
+		switch m.negation {
+		case Flip:
+			if opp, ok := m.opposites[c]; ok {
+				matches = append(matches, Match{Category: opp, Weight: weight})
+			}
+		case Weight:
+			matches = append(matches, Match{Category: c, Weight: weight * m.negatedWeight})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,96 @@
+package classifier
+
+import (
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+// corpusCase is a case of the modifiers corpus, it maps every negation mode to the weights of the matched categories.
+type corpusCase struct {
+	Text     string
+	Before   map[string]float64
+	None     map[string]float64
+	Suppress map[string]float64
+	Flip     map[string]float64
+	Weight   map[string]float64
+}
+
+// totalWeights sums up the weights of the matches of each category.
+func totalWeights(matches []Match) map[string]float64 {
+	weights := map[string]float64{}
+	for _, m := range matches {
+		weights[m.Category] += m.Weight
+	}
+	return weights
+}
+
+func sameWeights(a map[string]float64, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for c, w := range a {
+		if math.Abs(b[c]-w) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestModifiersCorpus(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/modifiers_corpus.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpus := []corpusCase{}
+	if err := yaml.Unmarshal(content, &corpus); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range corpus {
+		if out := totalWeights(Panas{}.Categorize(c.Text)); !sameWeights(out, c.Before) {
+			t.Errorf("Categorize failed for %q without modifiers, expected %v, got %v", c.Text, c.Before, out)
+		}
+		modes := map[NegationMode]map[string]float64{NoNegation: c.None, Suppress: c.Suppress, Flip: c.Flip, Weight: c.Weight}
+		for mode, expected := range modes {
+			mods, err := NewModifiers(mode, DefaultNegators, DefaultBoosters, DefaultScope, DefaultNegatedWeight)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := totalWeights(Panas{Modifiers: mods}.Categorize(c.Text)); !sameWeights(out, expected) {
+				t.Errorf("Categorize failed for %q with the %v negation, expected %v, got %v", c.Text, mode, expected, out)
+			}
+		}
+	}
+}
+
+func TestNewModifiers(t *testing.T) {
+	type testCase struct {
+		negation      NegationMode
+		negators      []string
+		boosters      map[string]float64
+		scope         int
+		negatedWeight float64
+		err           error
+	}
+	cases := []testCase{
+		testCase{negation: Flip, negators: []string{"Don't"}, boosters: map[string]float64{"Very": 2}, scope: 1},
+		testCase{negation: Weight, scope: 3, negatedWeight: 0.5},
+		testCase{negation: "invert", scope: 3, err: ErrInvalidModifiers},
+		testCase{negation: Weight, scope: 3, negatedWeight: 2, err: ErrInvalidModifiers},
+		testCase{negation: Suppress, scope: 0, err: ErrInvalidModifiers},
+		testCase{negation: Suppress, negators: []string{"not at all"}, scope: 3, err: ErrInvalidModifiers},
+		testCase{negation: Suppress, boosters: map[string]float64{"very": 0}, scope: 3, err: ErrInvalidModifiers},
+	}
+	for _, c := range cases {
+		if _, err := NewModifiers(c.negation, c.negators, c.boosters, c.scope, c.negatedWeight); !errors.Is(err, c.err) {
+			t.Errorf("NewModifiers failed for %+v, expected %v, got %v", c, c.err, err)
+		}
+	}
+	mods, _ := NewModifiers(Flip, []string{"Don't"}, map[string]float64{"Very": 2}, 1, 0)
+	expected := []Match{Match{Category: "sadness", Weight: 2}}
+	if out := (Panas{Modifiers: mods}).Categorize("I don't very happy"); !sameWeights(totalWeights(out), totalWeights(expected)) {
+		t.Errorf("Categorize failed, expected %v, got %v", expected, out)
+	}
+}
@@ -1,35 +1,303 @@
 // Package database exposes a DataStore interface.
 package database
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrTextNotFound is returned when a Text with the supplied ID doesn't exist.
+var ErrTextNotFound = errors.New("text not found")
+
+// ErrInvalidCursor is returned when a pagination cursor can not be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnknownCommunity is returned when no text has been received for a community.
+var ErrUnknownCommunity = errors.New("unknown community")
+
+// ErrNoBaseline is returned when a baseline has not been defined yet.
+var ErrNoBaseline = errors.New("no baseline")
+
+// ErrInvalidWindow is returned when a baseline window is empty, or holds no texts.
+var ErrInvalidWindow = errors.New("invalid baseline window")
+
+// ErrOpenWindow is returned when a baseline window that must be over is not over yet.
+var ErrOpenWindow = errors.New("baseline window is not over")
+
+// ErrInvalidBucket is returned when a time-series bucket width is not one of the available bucket widths.
+var ErrInvalidBucket = errors.New("invalid bucket")
+
 // ID represents ID of a Text, it is the string form of a UUID in the current implementation.
 type ID string
 
-// Category represents a sentiment category.
+// Category represents a sentiment category. The categories are defined by the classifier, the DataStore accepts any.
 type Category string
 
+// Community identifies a community, e.g. a hashtag or a group, whose sentiments are tracked separately.
+type Community string
+
+// DefaultCommunity is the community of the texts that are received without a community.
+const DefaultCommunity Community = "default"
+
+// DefaultLang is the language of the texts that are received without a language.
+const DefaultLang = "en"
+
 // Text specifies the text object to be stored in the DB.
 type Text struct {
 	ID
 	TextString string
+	// Categories are the sentiment categories detected in the text.
+	Categories []Category
+	// ReceivedAt is the time at which the text was received by the service.
+	ReceivedAt time.Time
+	// RequestID is the ID of the http request that carried the text.
+	RequestID string
+	// Community is the community in which the text was received.
+	Community Community
+	// Lang is the language of the text, as an ISO 639-1 code.
+	Lang string
+	// Seq is the insertion order of the text, the pagination of texts is based on it.
+	Seq uint64
+}
+
+// HasCategory checks if the category is one of the categories of the text.
+func (t Text) HasCategory(catg Category) bool {
+	for _, c := range t.Categories {
+		if c == catg {
+			return true
+		}
+	}
+	return false
+}
+
+// TextQuery specifies a page of texts to be fetched from the DB.
+type TextQuery struct {
+	// Category, if not empty, selects the texts of a sentiment category.
+	Category string
+	// Community, if not empty, selects the texts of a community.
+	Community Community
+	// Contains, if not empty, selects the texts that contain the substring, ignoring the case.
+	Contains string
+	// Lang, if not empty, selects the texts of a language.
+	Lang string
+	// Cursor is the NextCursor of the previous page, it is empty for the first page.
+	Cursor string
+	Limit  int
+}
+
+// TextPage is a page of texts, in their insertion order.
+type TextPage struct {
+	Texts []Text
+	// NextCursor is the cursor of the next page, it is empty if there are no more texts.
+	NextCursor string
 }
 
 // Sentiment represents the sentiment details of a category.
+// TextCount is the raw count of the texts of the category, and WeightedCount is the sum of their weights.
+// Value is the share of the category in the total weight of the texts, i.e. the WeightedCount divided by the sum
+// of the weights of the texts of all the categories, it ranges from 0 to 1.
 type Sentiment struct {
-	Value     float64
-	TextCount int
+	Value         float64
+	TextCount     int
+	WeightedCount float64
+}
+
+// SentimentUpdate specifies the texts count to be added to a sentiment category of a community,
+// at the time the texts were received. Weight is the weighted contribution of the texts, a nil Weight
+// indicates unweighted texts, i.e. a Weight equal to the Count, and a zero Weight texts that don't contribute.
+// An empty Community indicates the DefaultCommunity, and an empty Lang indicates the DefaultLang.
+type SentimentUpdate struct {
+	Community Community
+	Lang      string
+	Category  string
+	Count     int
+	Weight    *float64
+	At        time.Time
+	// RequestID is the ID of the http request that carried the texts, it is only logged.
+	RequestID string
+}
+
+// weight returns the weighted contribution of the update.
+func (u SentimentUpdate) weight() float64 {
+	if u.Weight == nil {
+		return float64(u.Count)
+	}
+	return *u.Weight
+}
+
+// HistoryResolution is the width of the buckets in which the sentiment history is recorded.
+// The history can be aggregated into buckets of any multiple of the resolution.
+const HistoryResolution = time.Minute
+
+// HistoryBucket holds the text counts of the categories that were updated within a HistoryResolution.
+type HistoryBucket struct {
+	TextCounts map[Category]int
+	// WeightedCounts holds the sum of the weights of the texts of the categories.
+	WeightedCounts map[Category]float64
+	TotalTexts     int
+	TotalWeight    float64
+}
+
+// BucketWidth represents the width of the buckets of a sentiment time-series.
+type BucketWidth string
+
+// Available bucket widths.
+const (
+	Minute BucketWidth = "minute"
+	Hour   BucketWidth = "hour"
+	Day    BucketWidth = "day"
+)
+
+// bucketDurations maps the available bucket widths to their durations.
+var bucketDurations = map[BucketWidth]time.Duration{
+	Minute: time.Minute,
+	Hour:   time.Hour,
+	Day:    24 * time.Hour,
+}
+
+// Duration returns the duration of the bucket width, and false if the bucket width is not available.
+func (b BucketWidth) Duration() (time.Duration, bool) {
+	d, ok := bucketDurations[b]
+	return d, ok
+}
+
+// SeriesQuery specifies a sentiment time-series to be fetched from the DB.
+type SeriesQuery struct {
+	// From is inclusive and To is exclusive. The series covers every bucket that overlaps the From - To range,
+	// so From is rounded down, and To is rounded up, to the bucket width.
+	From   time.Time
+	To     time.Time
+	Bucket BucketWidth
+	// Category, if not empty, selects a single sentiment category.
+	Category string
+	// Community, if not empty, selects the history of a community, rather than the history of all the communities.
+	Community Community
+}
+
+// SeriesBucket represents the sentiments computed from the texts received within a bucket of a time-series.
+type SeriesBucket struct {
+	Start       time.Time
+	Sentiments  map[Category]Sentiment
+	TotalTexts  int
+	TotalWeight float64
+}
+
+// BaselineWindow specifies the period whose sentiments are considered as the baseline.
+// It is either the first FirstDays days of the history, or the period from From (inclusive) to To (exclusive).
+// Community, if not empty, selects the history of a community, whose baseline is stored separately.
+// Closed requires the window to be over, so that the baseline is not frozen from a part of the window.
+type BaselineWindow struct {
+	FirstDays int
+	From      time.Time
+	To        time.Time
+	Community Community
+	Closed    bool `json:"-"`
+}
+
+// Baseline holds the sentiment values of the categories within a baseline period, as prescribed by the PANAS-t paper.
+// The sentiments are reported as a relative change against these values.
+// The Community is empty for the baseline of all the communities.
+type Baseline struct {
+	Community   Community `json:",omitempty"`
+	From        time.Time
+	To          time.Time
+	Values      map[Category]float64
+	TotalTexts  int
+	TotalWeight float64
+}
+
+// Relative returns the relative change of a sentiment value against the baseline value of the category,
+// and false if the baseline value of the category is 0.
+func (b Baseline) Relative(catg Category, value float64) (float64, bool) {
+	base := b.Values[catg]
+	if base == 0 {
+		return 0, false
+	}
+	return (value - base) / base, true
+}
+
+// LanguageData holds the sentiments of the texts of a single language.
+type LanguageData struct {
+	Sentiments  map[Category]Sentiment
+	TotalTexts  int
+	TotalWeight float64
+}
+
+// CommunityData holds the sentiments and the history of a single community.
+type CommunityData struct {
+	Sentiments  map[Category]Sentiment
+	TotalTexts  int
+	TotalWeight float64
+	History     map[int64]HistoryBucket
+	// Languages holds the sentiments of every language within the community.
+	Languages map[string]LanguageData
+	// Baseline is nil until a baseline of the community is frozen.
+	Baseline *Baseline `json:",omitempty"`
 }
 
 // Data is the main data-structure that the current implementation holds.
+// Sentiments, TotalTexts, TotalWeight and History are aggregated over all the communities.
+// TotalWeight is the sum of the weights of the texts of all the categories, the Values of the sentiments are
+// computed against it.
 type Data struct {
-	Texts      map[ID]Text
-	Sentiments map[Category]Sentiment
-	TotalTexts int
+	Texts       map[ID]Text
+	Sentiments  map[Category]Sentiment
+	TotalTexts  int
+	TotalWeight float64
+	// History maps the start of every HistoryResolution bucket, in unix seconds, to its text counts.
+	History map[int64]HistoryBucket
+	// Communities holds the data of every community, separately.
+	Communities map[Community]CommunityData
+	// Languages holds the sentiments of every language, across all the communities.
+	Languages map[string]LanguageData
+	// Baseline is nil until a baseline of all the communities is frozen.
+	Baseline *Baseline
+}
+
+// SentimentChange reports the sentiment of a category right after an update, across all the communities,
+// and within the community of the update.
+type SentimentChange struct {
+	Community            Community
+	Category             Category
+	Sentiment            Sentiment
+	TotalTexts           int
+	TotalWeight          float64
+	CommunitySentiment   Sentiment
+	CommunityTotalTexts  int
+	CommunityTotalWeight float64
+	At                   time.Time
+}
+
+// Observable is implemented by the DataStores that report the changes of the sentiments.
+type Observable interface {
+	// Observe registers a function that is called with every SentimentChange, in the order of the updates.
+	// The function is called while the DataStore is locked, so it must not block, nor call the DataStore.
+	Observe(observer func(SentimentChange))
+}
+
+// Pinger is implemented by the DataStores that can check that they are able to serve the operations,
+// e.g. that their storage is reachable.
+type Pinger interface {
+	Ping() error
 }
 
 // DataStore is a database interface that can be implemented by different kinds of databases.
 type DataStore interface {
-	InsertText(t string) (Text, error)
-	UpdateSentiment(catg string, tcount int) (map[Category]Sentiment, error)
-	FetchSentiments() (map[Category]Sentiment, error)
-	FetchCategorySentiments(catg string) (map[Category]Sentiment, error)
+	InsertText(t Text) (Text, error)
+	FetchText(id ID) (Text, error)
+	FetchTexts(q TextQuery) (TextPage, error)
+	UpdateSentiment(u SentimentUpdate) (map[Category]Sentiment, error)
+	// FetchSentiments and FetchCategorySentiments return the sentiments of a community,
+	// or the sentiments of all the communities if the community is empty.
+	FetchSentiments(comm Community) (map[Category]Sentiment, error)
+	FetchCategorySentiments(comm Community, catg string) (map[Category]Sentiment, error)
+	// FetchLanguageSentiments returns the sentiments of every language, within a community,
+	// or across all the communities if the community is empty.
+	FetchLanguageSentiments(comm Community) (map[string]map[Category]Sentiment, error)
+	FetchCommunities() ([]Community, error)
+	FetchTimeSeries(q SeriesQuery) ([]SeriesBucket, error)
+	// FreezeBaseline and FetchBaseline operate on the baseline of a community,
+	// or on the baseline of all the communities if the community is empty.
+	FreezeBaseline(w BaselineWindow) (Baseline, error)
+	FetchBaseline(comm Community) (Baseline, error)
 }
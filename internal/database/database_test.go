@@ -1,38 +1,143 @@
 package database
 
 import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/suite"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+// StoreSuite runs against every DataStore implementation.
+// newStore returns the DataStore under test, along with the MemoryDB that holds its data.
 type StoreSuite struct {
 	suite.Suite
-	memDB MemoryDB
+	newStore func() (DataStore, *MemoryDB)
+	store    DataStore
+	memDB    *MemoryDB
 }
 
 // Basic setup, instantiates the db
 func (s *StoreSuite) SetupSuite() {
-	s.memDB = MemoryDB{db: Data{Texts: map[ID]Text{}, Sentiments: map[Category]Sentiment{}, TotalTexts: 0}}
+	s.store, s.memDB = s.newStore()
 }
 
 // Every test cycle will start with this state
 func (s *StoreSuite) SetupTest() {
-	s.memDB = MemoryDB{db: Data{Texts: map[ID]Text{}, Sentiments: map[Category]Sentiment{}, TotalTexts: 0}}
+	s.closeStore()
+	s.store, s.memDB = s.newStore()
+}
+
+func (s *StoreSuite) TearDownSuite() {
+	s.closeStore()
+}
+
+func (s *StoreSuite) closeStore() {
+	if c, ok := s.store.(io.Closer); ok {
+		c.Close()
+	}
 }
 
 func TestStoreSuite(t *testing.T) {
 	s := new(StoreSuite)
+	s.newStore = func() (DataStore, *MemoryDB) {
+		memDB := &MemoryDB{db: Data{Texts: map[ID]Text{}, Sentiments: map[Category]Sentiment{}, TotalTexts: 0}}
+		return memDB, memDB
+	}
 	suite.Run(t, s)
 }
 
+func TestFileStoreSuite(t *testing.T) {
+	s := new(StoreSuite)
+	s.newStore = func() (DataStore, *MemoryDB) {
+		fdb, err := GetFileDatastore(tempDir(t), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fdb, &fdb.MemoryDB
+	}
+	suite.Run(t, s)
+}
+
+func newText(txt string, catgs ...Category) Text {
+	return Text{TextString: txt, Categories: catgs, ReceivedAt: time.Now().UTC(), RequestID: "req"}
+}
+
+func sameText(a Text, b Text) bool {
+	return a.ID == b.ID && a.TextString == b.TextString && reflect.DeepEqual(a.Categories, b.Categories) &&
+		a.ReceivedAt.Equal(b.ReceivedAt) && a.RequestID == b.RequestID && a.Seq == b.Seq
+}
+
 func (s *StoreSuite) TestInsertText() {
 	testCase := "I am happy"
-	txt, _ := s.memDB.InsertText(testCase)
+	txt, _ := s.store.InsertText(newText(testCase, "jovility"))
 	inserted := s.memDB.db.Texts[txt.ID].TextString
 	expected := testCase
 	if inserted != expected {
 		s.T().Errorf("Insert failed, expected %v, got %v", expected, inserted)
 	}
+	if !s.memDB.db.Texts[txt.ID].HasCategory(Category("jovility")) {
+		s.T().Errorf("Insert failed, expected category %v, got %v", "jovility", s.memDB.db.Texts[txt.ID].Categories)
+	}
+}
+
+func (s *StoreSuite) TestFetchText() {
+	txt, _ := s.store.InsertText(newText("I am happy", "jovility"))
+	fetched, err := s.store.FetchText(txt.ID)
+	if err != nil || !sameText(fetched, txt) {
+		s.T().Errorf("Fetch failed, expected %v, got %v, %v", txt, fetched, err)
+	}
+	_, err = s.store.FetchText(ID("missing"))
+	if !errors.Is(err, ErrTextNotFound) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrTextNotFound, err)
+	}
+}
+
+func (s *StoreSuite) TestFetchTexts() {
+	s.store.InsertText(newText("I am happy", "jovility"))
+	s.store.InsertText(newText("I am sad", "sadness"))
+	s.store.InsertText(newText("I am so HAPPY", "jovility"))
+	s.store.InsertText(newText("I feel happy", "jovility"))
+	type testCase struct {
+		query    TextQuery
+		expected []string
+	}
+	cases := []testCase{
+		testCase{query: TextQuery{}, expected: []string{"I am happy", "I am sad", "I am so HAPPY", "I feel happy"}},
+		testCase{query: TextQuery{Category: "sadness"}, expected: []string{"I am sad"}},
+		testCase{query: TextQuery{Contains: "am so happy"}, expected: []string{"I am so HAPPY"}},
+		testCase{query: TextQuery{Category: "jovility", Contains: "i am"}, expected: []string{"I am happy", "I am so HAPPY"}},
+	}
+	for _, c := range cases {
+		// Walk through the pages, one text per page.
+		out := []string{}
+		q := c.query
+		q.Limit = 1
+		for {
+			page, err := s.store.FetchTexts(q)
+			if err != nil {
+				s.T().Fatalf("Fetch failed: %v", err)
+			}
+			for _, txt := range page.Texts {
+				out = append(out, txt.TextString)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		if strings.Join(out, ",") != strings.Join(c.expected, ",") {
+			s.T().Errorf("Fetch failed for %+v, expected %v, got %v", c.query, c.expected, out)
+		}
+	}
+	if _, err := s.store.FetchTexts(TextQuery{Cursor: "abc"}); !errors.Is(err, ErrInvalidCursor) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrInvalidCursor, err)
+	}
 }
 
 func (s *StoreSuite) TestFetchSentiments() {
@@ -41,7 +146,7 @@ func (s *StoreSuite) TestFetchSentiments() {
 		Category("sadness"):  Sentiment{Value: 0.5, TextCount: 1},
 	}
 	s.memDB.db.Sentiments = sentiments
-	updatedSents := s.memDB.db.Sentiments
+	updatedSents, _ := s.store.FetchSentiments("")
 	for k, v := range updatedSents {
 		if sentiments[k].Value != v.Value {
 			s.T().Errorf("Fetch failed, expected %v, got %v", sentiments[k].Value, v.Value)
@@ -56,7 +161,7 @@ func (s *StoreSuite) TestFetchCategorySentiments() {
 	}
 	s.memDB.db.Sentiments = sentiments
 	testCategory := "jovility"
-	updatedSents, _ := s.memDB.FetchCategorySentiments(testCategory)
+	updatedSents, _ := s.store.FetchCategorySentiments("", testCategory)
 	expected := sentiments[Category(testCategory)].Value
 	out := updatedSents[Category(testCategory)].Value
 	if expected != out {
@@ -67,7 +172,7 @@ func (s *StoreSuite) TestFetchCategorySentiments() {
 func (s *StoreSuite) TestUpdateSentiment() {
 	s.memDB.db.Sentiments = map[Category]Sentiment{Category("jovility"): Sentiment{Value: 0.5, TextCount: 1}}
 	s.memDB.db.TotalTexts = 1
-	s.memDB.UpdateSentiment("sadness", 1)
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: time.Now()})
 	updatedJovSents := s.memDB.db.Sentiments[Category("jovility")].Value
 	updatedJovTexts := s.memDB.db.Sentiments[Category("jovility")].TextCount
 	updatedSadSents := s.memDB.db.Sentiments[Category("sadness")].Value
@@ -77,3 +182,307 @@ func (s *StoreSuite) TestUpdateSentiment() {
 		s.T().Errorf("Update failed, updatedJovilitySents: %v, updatedJovilityTexts: %v, updatedSadnessSents: %v, updatedSadnessTexts: %v, updatedTotalTexts: %v", updatedJovSents, updatedJovTexts, updatedSadSents, updatedSadTexts, updatedTotalTexts)
 	}
 }
+
+// weight returns the weight of a SentimentUpdate.
+func weight(w float64) *float64 {
+	return &w
+}
+
+func (s *StoreSuite) TestWeightedSentiments() {
+	at := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, Weight: weight(0.5), At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, Weight: weight(1.5), At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "fear", Count: 1, Weight: weight(0), At: at})
+	// The values are the shares of the categories in the total weight, 3, and a zero weight doesn't contribute.
+	expected := map[Category]Sentiment{
+		"jovility": Sentiment{Value: 2.0 / 3, TextCount: 2, WeightedCount: 2},
+		"sadness":  Sentiment{Value: 1.0 / 3, TextCount: 1, WeightedCount: 1},
+		"fear":     Sentiment{Value: 0, TextCount: 1, WeightedCount: 0},
+	}
+	if sents, _ := s.store.FetchSentiments(""); !reflect.DeepEqual(sents, expected) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", expected, sents)
+	}
+	series, _ := s.store.FetchTimeSeries(SeriesQuery{From: at, To: at.Add(time.Hour), Bucket: Hour})
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Sentiments, expected) || series[0].TotalWeight != 3 {
+		s.T().Errorf("Fetch failed, expected %v, got %v", expected, series)
+	}
+	b, _ := s.store.FreezeBaseline(BaselineWindow{FirstDays: 1})
+	if b.Values["sadness"] != 1.0/3 || b.TotalWeight != 3 {
+		s.T().Errorf("Freeze failed, expected a sadness value of %v, got %v", 1.0/3, b.Values["sadness"])
+	}
+}
+
+func (s *StoreSuite) TestFetchTimeSeries() {
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(10 * time.Minute)})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: day.Add(10*time.Minute + 30*time.Second)})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(70 * time.Minute)})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "fear", Count: 1, At: day.Add(25 * time.Hour)})
+	type testCase struct {
+		query    SeriesQuery
+		starts   []time.Time
+		totals   []int
+		jovility []float64
+	}
+	cases := []testCase{
+		testCase{
+			query:    SeriesQuery{From: day, To: day.Add(48 * time.Hour), Bucket: Minute},
+			starts:   []time.Time{day.Add(10 * time.Minute), day.Add(70 * time.Minute), day.Add(25 * time.Hour)},
+			totals:   []int{2, 1, 1},
+			jovility: []float64{0.5, 1, 0},
+		},
+		testCase{
+			query:    SeriesQuery{From: day, To: day.Add(48 * time.Hour), Bucket: Hour, Category: "jovility"},
+			starts:   []time.Time{day, day.Add(time.Hour), day.Add(25 * time.Hour)},
+			totals:   []int{2, 1, 1},
+			jovility: []float64{0.5, 1, 0},
+		},
+		// From is rounded down, and To is rounded up, to the bucket width.
+		testCase{
+			query:    SeriesQuery{From: day.Add(time.Hour), To: day.Add(47 * time.Hour), Bucket: Day},
+			starts:   []time.Time{day, day.Add(24 * time.Hour)},
+			totals:   []int{3, 1},
+			jovility: []float64{2.0 / 3, 0},
+		},
+		// To falls within the bucket of From.
+		testCase{
+			query:    SeriesQuery{From: day.Add(25 * time.Hour), To: day.Add(25 * time.Hour), Bucket: Day},
+			starts:   []time.Time{day.Add(24 * time.Hour)},
+			totals:   []int{1},
+			jovility: []float64{0},
+		},
+		// To is the start of a bucket, the bucket is not returned.
+		testCase{
+			query:    SeriesQuery{From: day, To: day.Add(time.Hour), Bucket: Hour},
+			starts:   []time.Time{day},
+			totals:   []int{2},
+			jovility: []float64{0.5},
+		},
+	}
+	for _, c := range cases {
+		series, err := s.store.FetchTimeSeries(c.query)
+		if err != nil {
+			s.T().Fatalf("Fetch failed: %v", err)
+		}
+		if len(series) != len(c.starts) {
+			s.T().Errorf("Fetch failed for %+v, expected %v buckets, got %v", c.query, len(c.starts), series)
+			continue
+		}
+		for i, b := range series {
+			if !b.Start.Equal(c.starts[i]) || b.TotalTexts != c.totals[i] || b.Sentiments["jovility"].Value != c.jovility[i] {
+				s.T().Errorf("Fetch failed for %+v, unexpected bucket %v: %+v", c.query, i, b)
+			}
+			if c.query.Category != "" && len(b.Sentiments) > 1 {
+				s.T().Errorf("Fetch failed for %+v, expected only %v, got %v", c.query, c.query.Category, b.Sentiments)
+			}
+		}
+	}
+	if _, err := s.store.FetchTimeSeries(SeriesQuery{Bucket: "week"}); !errors.Is(err, ErrInvalidBucket) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrInvalidBucket, err)
+	}
+}
+
+func (s *StoreSuite) TestFreezeBaseline() {
+	if _, err := s.store.FetchBaseline(""); !errors.Is(err, ErrNoBaseline) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrNoBaseline, err)
+	}
+	if _, err := s.store.FreezeBaseline(BaselineWindow{FirstDays: 1}); !errors.Is(err, ErrInvalidWindow) {
+		s.T().Errorf("Freeze failed, expected %v, got %v", ErrInvalidWindow, err)
+	}
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(10 * time.Minute)})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: day.Add(20 * time.Minute)})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(25 * time.Hour)})
+	type testCase struct {
+		window   BaselineWindow
+		from     time.Time
+		total    int
+		jovility float64
+	}
+	cases := []testCase{
+		testCase{window: BaselineWindow{FirstDays: 1}, from: day.Add(10 * time.Minute), total: 2, jovility: 0.5},
+		testCase{window: BaselineWindow{From: day, To: day.Add(48 * time.Hour)}, from: day, total: 3, jovility: 2.0 / 3},
+	}
+	for _, c := range cases {
+		b, err := s.store.FreezeBaseline(c.window)
+		if err != nil {
+			s.T().Fatalf("Freeze failed: %v", err)
+		}
+		if !b.From.Equal(c.from) || b.TotalTexts != c.total || b.Values["jovility"] != c.jovility {
+			s.T().Errorf("Freeze failed for %+v, unexpected baseline %+v", c.window, b)
+		}
+		fetched, err := s.store.FetchBaseline("")
+		if err != nil || !reflect.DeepEqual(fetched.Values, b.Values) {
+			s.T().Errorf("Fetch failed, expected %+v, got %+v, %v", b, fetched, err)
+		}
+	}
+	invalid := []BaselineWindow{
+		BaselineWindow{From: day, To: day},
+		BaselineWindow{From: day.Add(72 * time.Hour), To: day.Add(96 * time.Hour)},
+	}
+	for _, w := range invalid {
+		if _, err := s.store.FreezeBaseline(w); !errors.Is(err, ErrInvalidWindow) {
+			s.T().Errorf("Freeze failed for %+v, expected %v, got %v", w, ErrInvalidWindow, err)
+		}
+	}
+	// A closed window that is not over is not frozen, the end of the window is returned.
+	to := time.Now().Add(time.Hour)
+	b, err := s.store.FreezeBaseline(BaselineWindow{From: day, To: to, Closed: true})
+	if !errors.Is(err, ErrOpenWindow) || !b.To.Equal(to) {
+		s.T().Errorf("Freeze failed, expected %v and %v, got %v and %v", ErrOpenWindow, to, err, b.To)
+	}
+	if fetched, _ := s.store.FetchBaseline(""); !fetched.To.Equal(day.Add(48 * time.Hour)) {
+		s.T().Errorf("Freeze failed, the baseline was replaced by an open window: %+v", fetched)
+	}
+}
+
+func (s *StoreSuite) TestCommunities() {
+	at := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	txt := newText("I am happy", "jovility")
+	txt.Community = "#friday"
+	s.store.InsertText(txt)
+	s.store.InsertText(newText("I am sad", "sadness"))
+	s.store.UpdateSentiment(SentimentUpdate{Community: "#friday", Category: "jovility", Count: 1, At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: at})
+	type testCase struct {
+		comm     Community
+		jovility Sentiment
+		sadness  Sentiment
+	}
+	cases := []testCase{
+		testCase{comm: "", jovility: Sentiment{Value: 1.0 / 3, TextCount: 1, WeightedCount: 1}, sadness: Sentiment{Value: 2.0 / 3, TextCount: 2, WeightedCount: 2}},
+		testCase{comm: "#friday", jovility: Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}},
+		testCase{comm: DefaultCommunity, sadness: Sentiment{Value: 1, TextCount: 2, WeightedCount: 2}},
+	}
+	for _, c := range cases {
+		sents, err := s.store.FetchSentiments(c.comm)
+		if err != nil || sents["jovility"] != c.jovility || sents["sadness"] != c.sadness {
+			s.T().Errorf("Fetch failed for %q, expected %v and %v, got %v, %v", c.comm, c.jovility, c.sadness, sents, err)
+		}
+		series, err := s.store.FetchTimeSeries(SeriesQuery{From: at, To: at.Add(time.Hour), Bucket: Hour, Community: c.comm})
+		if err != nil || len(series) != 1 || series[0].Sentiments["jovility"] != c.jovility {
+			s.T().Errorf("Fetch failed for %q, expected %v, got %v, %v", c.comm, c.jovility, series, err)
+		}
+	}
+	if _, err := s.store.FetchSentiments("#sunday"); !errors.Is(err, ErrUnknownCommunity) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrUnknownCommunity, err)
+	}
+	if _, err := s.store.FetchCategorySentiments("#sunday", "jovility"); !errors.Is(err, ErrUnknownCommunity) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrUnknownCommunity, err)
+	}
+	// The baselines of the communities are frozen from their own history, and stored separately.
+	if _, err := s.store.FetchBaseline("#friday"); !errors.Is(err, ErrNoBaseline) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrNoBaseline, err)
+	}
+	if b, err := s.store.FreezeBaseline(BaselineWindow{FirstDays: 1, Community: "#friday"}); err != nil || b.Values["jovility"] != 1 {
+		s.T().Errorf("Freeze failed, expected a jovility value of %v, got %+v, %v", 1, b, err)
+	}
+	if b, err := s.store.FetchBaseline("#friday"); err != nil || b.Community != "#friday" || b.TotalTexts != 1 {
+		s.T().Errorf("Fetch failed, expected the baseline of %v, got %+v, %v", "#friday", b, err)
+	}
+	if _, err := s.store.FetchBaseline(""); !errors.Is(err, ErrNoBaseline) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrNoBaseline, err)
+	}
+	if _, err := s.store.FreezeBaseline(BaselineWindow{FirstDays: 1, Community: "#sunday"}); !errors.Is(err, ErrUnknownCommunity) {
+		s.T().Errorf("Freeze failed, expected %v, got %v", ErrUnknownCommunity, err)
+	}
+	if _, err := s.store.FetchBaseline("#sunday"); !errors.Is(err, ErrUnknownCommunity) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrUnknownCommunity, err)
+	}
+	comms, _ := s.store.FetchCommunities()
+	if !reflect.DeepEqual(comms, []Community{"#friday", DefaultCommunity}) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", []Community{"#friday", DefaultCommunity}, comms)
+	}
+	page, _ := s.store.FetchTexts(TextQuery{Community: DefaultCommunity})
+	if len(page.Texts) != 1 || page.Texts[0].TextString != "I am sad" {
+		s.T().Errorf("Fetch failed, expected the text of %v, got %v", DefaultCommunity, page.Texts)
+	}
+}
+
+func (s *StoreSuite) TestLanguages() {
+	at := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	txt := newText("Estoy feliz", "jovility")
+	txt.Lang = "es"
+	s.store.InsertText(txt)
+	s.store.InsertText(newText("I am sad", "sadness"))
+	s.store.UpdateSentiment(SentimentUpdate{Community: "#friday", Lang: "es", Category: "jovility", Count: 1, At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: at})
+	type testCase struct {
+		comm     Community
+		expected map[string]map[Category]Sentiment
+	}
+	cases := []testCase{
+		testCase{comm: "", expected: map[string]map[Category]Sentiment{
+			"es":        {"jovility": Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}},
+			DefaultLang: {"sadness": Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}},
+		}},
+		testCase{comm: "#friday", expected: map[string]map[Category]Sentiment{
+			"es": {"jovility": Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}},
+		}},
+	}
+	for _, c := range cases {
+		sents, err := s.store.FetchLanguageSentiments(c.comm)
+		if err != nil || !reflect.DeepEqual(sents, c.expected) {
+			s.T().Errorf("Fetch failed for %q, expected %v, got %v, %v", c.comm, c.expected, sents, err)
+		}
+	}
+	if _, err := s.store.FetchLanguageSentiments("#sunday"); !errors.Is(err, ErrUnknownCommunity) {
+		s.T().Errorf("Fetch failed, expected %v, got %v", ErrUnknownCommunity, err)
+	}
+	page, _ := s.store.FetchTexts(TextQuery{Lang: DefaultLang})
+	if len(page.Texts) != 1 || page.Texts[0].TextString != "I am sad" {
+		s.T().Errorf("Fetch failed, expected the text of %v, got %v", DefaultLang, page.Texts)
+	}
+}
+
+func (s *StoreSuite) TestObserve() {
+	var changes []SentimentChange
+	s.store.(Observable).Observe(func(c SentimentChange) { changes = append(changes, c) })
+	at := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	s.store.UpdateSentiment(SentimentUpdate{Community: "#friday", Category: "jovility", Count: 1, At: at})
+	s.store.UpdateSentiment(SentimentUpdate{Category: "sadness", Count: 1, At: at})
+	expected := []SentimentChange{
+		SentimentChange{Community: "#friday", Category: "jovility", Sentiment: Sentiment{Value: 1, TextCount: 1, WeightedCount: 1},
+			TotalTexts: 1, TotalWeight: 1, CommunitySentiment: Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}, CommunityTotalTexts: 1,
+			CommunityTotalWeight: 1, At: at},
+		SentimentChange{Community: DefaultCommunity, Category: "sadness", Sentiment: Sentiment{Value: 0.5, TextCount: 1, WeightedCount: 1},
+			TotalTexts: 2, TotalWeight: 2, CommunitySentiment: Sentiment{Value: 1, TextCount: 1, WeightedCount: 1}, CommunityTotalTexts: 1,
+			CommunityTotalWeight: 1, At: at},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		s.T().Errorf("Observe failed, expected %v, got %v", expected, changes)
+	}
+}
+
+// observations returns the number of the latencies observed by a histogram.
+func observations(h prometheus.Observer) uint64 {
+	var m dto.Metric
+	h.(prometheus.Metric).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrument(t *testing.T) {
+	mdb := GetDatastore()
+	db := Instrument(mdb)
+	var changes int
+	db.Observe(func(SentimentChange) { changes++ })
+	inserts := observations(opDuration.WithLabelValues("insertText"))
+	errs := testutil.ToFloat64(opErrors.WithLabelValues("fetchText"))
+	txt, _ := db.InsertText(newText("I am happy", "jovility"))
+	db.FetchText(txt.ID)
+	db.FetchText("unknown")
+	db.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+	observed := observations(opDuration.WithLabelValues("insertText")) - inserts
+	failed := testutil.ToFloat64(opErrors.WithLabelValues("fetchText")) - errs
+	if observed != 1 || failed != 1 {
+		t.Errorf("Failed: expected an insertText latency and a fetchText error, got %v and %v", observed, failed)
+	}
+	if changes != 1 {
+		t.Errorf("Failed: expected the changes of the wrapped DataStore, got %v", changes)
+	}
+	if _, err := mdb.FetchText(txt.ID); err != nil {
+		t.Errorf("Failed: expected the text in the wrapped DataStore, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+/*
+filedb offers a durable implementation of the DataStore interface.
+It keeps the working data in memory, exactly like MemoryDB, and additionally appends every mutation
+to a log file on the local disk. The log is periodically compacted into a snapshot of the Data.
+On startup, the snapshot is loaded and the log is replayed on top of it, which recovers the state
+that was held before a restart or a crash.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	logFileName      = "data.log"
+)
+
+// Operations that are recorded in the log.
+const (
+	opInsertText      = "insertText"
+	opUpdateSentiment = "updateSentiment"
+	opSetBaseline     = "setBaseline"
+)
+
+// logRecord is a single entry of the append-only log.
+// Seq increases monotonically, and lets the recovery skip the entries that are already part of the snapshot.
+type logRecord struct {
+	Seq       uint64
+	Op        string
+	Text      *Text     `json:",omitempty"`
+	Community Community `json:",omitempty"`
+	Lang      string    `json:",omitempty"`
+	Category  string    `json:",omitempty"`
+	Count     int       `json:",omitempty"`
+	Weight    *float64  `json:",omitempty"`
+	At        time.Time `json:",omitempty"`
+	Baseline  *Baseline `json:",omitempty"`
+}
+
+// snapshot is the compacted form of the log.
+type snapshot struct {
+	Seq  uint64
+	Data Data
+}
+
+// FileDB indicates a file-backed database. It embeds a MemoryDB that serves all the reads.
+type FileDB struct {
+	MemoryDB
+	dir     string
+	logMux  sync.Mutex
+	logFile *os.File
+	seq     uint64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// GetFileDatastore instantiates a FileDB that persists its data in the supplied directory.
+// The existing data in the directory, if any, is recovered before the FileDB is returned.
+// The log is compacted at every compactionInterval, a non-positive interval disables the periodic compaction.
+func GetFileDatastore(dir string, compactionInterval time.Duration) (*FileDB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create the data directory %v: %v", dir, err)
+	}
+	fdb := FileDB{
+		MemoryDB: MemoryDB{db: Data{Texts: map[ID]Text{}, Sentiments: map[Category]Sentiment{}, TotalTexts: 0}},
+		dir:      dir,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := fdb.recover(); err != nil {
+		return nil, err
+	}
+	go fdb.compactPeriodically(compactionInterval)
+	return &fdb, nil
+}
+
+// InsertText is exposed by DataStore interface. FileDB implements this method.
+func (fdb *FileDB) InsertText(t Text) (Text, error) {
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	txt, err := fdb.MemoryDB.InsertText(t)
+	if err != nil {
+		return txt, err
+	}
+	if err := fdb.appendLog(logRecord{Op: opInsertText, Text: &txt}); err != nil {
+		return txt, err
+	}
+	return txt, nil
+}
+
+// UpdateSentiment is exposed by DataStore interface. FileDB implements this method.
+// The update is logged first, so that a replay of the log produces the same sentiments.
+func (fdb *FileDB) UpdateSentiment(u SentimentUpdate) (map[Category]Sentiment, error) {
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	rec := logRecord{Op: opUpdateSentiment, Community: u.Community, Lang: u.Lang, Category: u.Category, Count: u.Count,
+		Weight: u.Weight, At: u.At}
+	if err := fdb.appendLog(rec); err != nil {
+		return map[Category]Sentiment{}, err
+	}
+	return fdb.MemoryDB.UpdateSentiment(u)
+}
+
+// FreezeBaseline is exposed by DataStore interface. FileDB implements this method.
+// The computed baseline is logged, rather than the window, so that a replay doesn't depend on the history.
+func (fdb *FileDB) FreezeBaseline(w BaselineWindow) (Baseline, error) {
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	b, err := fdb.MemoryDB.FreezeBaseline(w)
+	if err != nil {
+		return b, err
+	}
+	if err := fdb.appendLog(logRecord{Op: opSetBaseline, Baseline: &b}); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// Compact writes a snapshot of the current data and truncates the log.
+func (fdb *FileDB) Compact() error {
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	return fdb.compact()
+}
+
+// Close stops the periodic compaction, compacts the log one last time, and closes the log file.
+func (fdb *FileDB) Close() error {
+	close(fdb.stop)
+	<-fdb.done
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	err := fdb.compact()
+	if closeErr := fdb.logFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Ping is exposed by Pinger interface. FileDB implements this method.
+// It checks that the log is still open, and that it is still in the data directory.
+func (fdb *FileDB) Ping() error {
+	if err := fdb.MemoryDB.Ping(); err != nil {
+		return err
+	}
+	fdb.logMux.Lock()
+	defer fdb.logMux.Unlock()
+	if _, err := fdb.logFile.Stat(); err != nil {
+		return fmt.Errorf("The log is not available: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(fdb.dir, logFileName)); err != nil {
+		return fmt.Errorf("The log is not available: %v", err)
+	}
+	return nil
+}
+
+// appendLog writes a record to the log. The caller must hold the logMux.
+func (fdb *FileDB) appendLog(rec logRecord) error {
+	rec.Seq = fdb.seq + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("Failed to encode the log record: %v", err)
+	}
+	if _, err := fdb.logFile.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Failed to write to the log: %v", err)
+	}
+	fdb.seq = rec.Seq
+	return nil
+}
+
+// compact writes the snapshot to a temporary file and renames it, so that a crash never leaves
+// a partially written snapshot behind. The caller must hold the logMux.
+func (fdb *FileDB) compact() error {
+	content, err := json.Marshal(snapshot{Seq: fdb.seq, Data: fdb.db})
+	if err != nil {
+		return fmt.Errorf("Failed to encode the snapshot: %v", err)
+	}
+	tmpPath := filepath.Join(fdb.dir, snapshotFileName+".tmp")
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("Failed to create the snapshot: %v", err)
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write the snapshot: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(fdb.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("Failed to replace the snapshot: %v", err)
+	}
+	// The log entries are part of the snapshot now. If the truncation fails, they are skipped
+	// by the recovery, based on their Seq.
+	if err := fdb.logFile.Truncate(0); err != nil {
+		return fmt.Errorf("Failed to truncate the log: %v", err)
+	}
+	if _, err := fdb.logFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to truncate the log: %v", err)
+	}
+	return nil
+}
+
+func (fdb *FileDB) compactPeriodically(interval time.Duration) {
+	defer close(fdb.done)
+	if interval <= 0 {
+		<-fdb.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := fdb.Compact(); err != nil {
+				logging.Error("Error while compacting the log", logging.Fields{"error": err, "dir": fdb.dir})
+			}
+		case <-fdb.stop:
+			return
+		}
+	}
+}
+
+// recover loads the snapshot and replays the log on top of it.
+// A partially written record at the end of the log (the result of a crash in the middle of a write)
+// is discarded, and the log is truncated to the last complete record.
+func (fdb *FileDB) recover() error {
+	content, err := ioutil.ReadFile(filepath.Join(fdb.dir, snapshotFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read the snapshot: %v", err)
+	}
+	if err == nil {
+		snap := snapshot{Data: Data{Texts: map[ID]Text{}, Sentiments: map[Category]Sentiment{}}}
+		if err := json.Unmarshal(content, &snap); err != nil {
+			return fmt.Errorf("Failed to decode the snapshot: %v", err)
+		}
+		fdb.db = snap.Data
+		if fdb.db.Texts == nil {
+			fdb.db.Texts = map[ID]Text{}
+		}
+		if fdb.db.Sentiments == nil {
+			fdb.db.Sentiments = map[Category]Sentiment{}
+		}
+		fdb.seq = snap.Seq
+		fdb.reindex()
+	}
+	logFile, err := os.OpenFile(filepath.Join(fdb.dir, logFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open the log: %v", err)
+	}
+	fdb.logFile = logFile
+	var offset int64
+	reader := bufio.NewReader(logFile)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("Failed to read the log: %v", readErr)
+		}
+		complete := readErr == nil
+		var rec logRecord
+		if !complete || json.Unmarshal(bytes.TrimSpace(line), &rec) != nil {
+			if len(line) > 0 {
+				logging.Warn("Discarding a partially written log record", logging.Fields{"offset": offset, "dir": fdb.dir})
+			}
+			break
+		}
+		offset += int64(len(line))
+		if rec.Seq <= fdb.seq {
+			continue
+		}
+		fdb.replay(rec)
+		fdb.seq = rec.Seq
+	}
+	if err := logFile.Truncate(offset); err != nil {
+		return fmt.Errorf("Failed to truncate the log: %v", err)
+	}
+	if _, err := logFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek the log: %v", err)
+	}
+	return nil
+}
+
+// replay applies a log record to the in-memory data.
+func (fdb *FileDB) replay(rec logRecord) {
+	switch rec.Op {
+	case opInsertText:
+		if rec.Text != nil {
+			fdb.putText(*rec.Text)
+		}
+	case opUpdateSentiment:
+		u := SentimentUpdate{Community: rec.Community, Lang: rec.Lang, Category: rec.Category, Count: rec.Count,
+			Weight: rec.Weight, At: rec.At}
+		fdb.MemoryDB.UpdateSentiment(u)
+	case opSetBaseline:
+		if rec.Baseline != nil {
+			fdb.setBaseline(*rec.Baseline)
+		}
+	default:
+		logging.Warn("Skipping an unknown log record", logging.Fields{"op": rec.Op, "seq": rec.Seq})
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "filedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// reopen closes the FileDB without compacting it, the way a crash would leave it, and recovers it.
+func reopen(t *testing.T, fdb *FileDB) *FileDB {
+	close(fdb.stop)
+	<-fdb.done
+	fdb.logFile.Close()
+	recovered, err := GetFileDatastore(fdb.dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recovered
+}
+
+func fillFileDB(t *testing.T, dir string) *FileDB {
+	fdb, err := GetFileDatastore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdb.InsertText(newText("I am happy", "jovility"))
+	fdb.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+	fdb.InsertText(newText("I am sad", "sadness"))
+	fdb.UpdateSentiment(SentimentUpdate{Community: "#monday", Lang: "pt", Category: "sadness", Count: 1, Weight: weight(0.5), At: time.Now()})
+	return fdb
+}
+
+func assertRecovered(t *testing.T, expected *FileDB, recovered *FileDB) {
+	if len(recovered.db.Texts) != len(expected.db.Texts) {
+		t.Errorf("Failed: expected %v texts, recieved %v", len(expected.db.Texts), len(recovered.db.Texts))
+	}
+	for id, txt := range expected.db.Texts {
+		if !sameText(recovered.db.Texts[id], txt) {
+			t.Errorf("Failed: expected text %v, recieved %v", txt, recovered.db.Texts[id])
+		}
+	}
+	if recovered.db.TotalTexts != expected.db.TotalTexts {
+		t.Errorf("Failed: expected TotalTexts %v, recieved %v", expected.db.TotalTexts, recovered.db.TotalTexts)
+	}
+	if recovered.db.TotalWeight != expected.db.TotalWeight {
+		t.Errorf("Failed: expected TotalWeight %v, recieved %v", expected.db.TotalWeight, recovered.db.TotalWeight)
+	}
+	if !reflect.DeepEqual(recovered.db.History, expected.db.History) {
+		t.Errorf("Failed: expected History %v, recieved %v", expected.db.History, recovered.db.History)
+	}
+	if !reflect.DeepEqual(recovered.db.Languages, expected.db.Languages) {
+		t.Errorf("Failed: expected Languages %v, recieved %v", expected.db.Languages, recovered.db.Languages)
+	}
+	if !reflect.DeepEqual(recovered.db.Communities, expected.db.Communities) {
+		t.Errorf("Failed: expected Communities %v, recieved %v", expected.db.Communities, recovered.db.Communities)
+	}
+	for k, v := range expected.db.Sentiments {
+		if recovered.db.Sentiments[k] != v {
+			t.Errorf("Failed: expected %v sentiment %v, recieved %v", k, v, recovered.db.Sentiments[k])
+		}
+	}
+}
+
+func TestFileDBRecoversFromLog(t *testing.T) {
+	fdb := fillFileDB(t, tempDir(t))
+	recovered := reopen(t, fdb)
+	defer recovered.Close()
+	assertRecovered(t, fdb, recovered)
+}
+
+func TestFileDBRecoversFromSnapshotAndLog(t *testing.T) {
+	fdb := fillFileDB(t, tempDir(t))
+	if err := fdb.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	fdb.InsertText(newText("I feel happy", "jovility"))
+	fdb.UpdateSentiment(SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+	recovered := reopen(t, fdb)
+	defer recovered.Close()
+	assertRecovered(t, fdb, recovered)
+	page, _ := recovered.FetchTexts(TextQuery{})
+	expected := []string{"I am happy", "I am sad", "I feel happy"}
+	for i, txt := range page.Texts {
+		if txt.TextString != expected[i] {
+			t.Errorf("Failed: expected text %v at %v, recieved %v", expected[i], i, txt.TextString)
+		}
+	}
+	if recovered.db.Sentiments["jovility"].TextCount != 2 {
+		t.Errorf("Failed: expected jovility TextCount %v, recieved %v", 2, recovered.db.Sentiments["jovility"].TextCount)
+	}
+}
+
+func TestFileDBCompactTruncatesLog(t *testing.T) {
+	fdb := fillFileDB(t, tempDir(t))
+	defer fdb.Close()
+	if err := fdb.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(fdb.dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Failed: expected an empty log, recieved %v bytes", info.Size())
+	}
+}
+
+func TestFileDBDiscardsPartialRecord(t *testing.T) {
+	fdb := fillFileDB(t, tempDir(t))
+	fdb.logFile.Write([]byte(`{"Seq":5,"Op":"updateSent`))
+	recovered := reopen(t, fdb)
+	assertRecovered(t, fdb, recovered)
+	// The torn record must not break the records appended after the recovery.
+	recovered.UpdateSentiment(SentimentUpdate{Category: "fear", Count: 1, At: time.Now()})
+	again := reopen(t, recovered)
+	defer again.Close()
+	if again.db.Sentiments["fear"].TextCount != 1 {
+		t.Errorf("Failed: expected fear TextCount %v, recieved %v", 1, again.db.Sentiments["fear"].TextCount)
+	}
+}
+
+func TestFileDBRecoversBaseline(t *testing.T) {
+	fdb := fillFileDB(t, tempDir(t))
+	for _, comm := range []Community{"", "#monday"} {
+		if _, err := fdb.FreezeBaseline(BaselineWindow{FirstDays: 1, Community: comm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recovered := reopen(t, fdb)
+	defer recovered.Close()
+	for _, comm := range []Community{"", "#monday"} {
+		b, _ := fdb.FetchBaseline(comm)
+		rb, err := recovered.FetchBaseline(comm)
+		if err != nil || !rb.From.Equal(b.From) || !rb.To.Equal(b.To) || !reflect.DeepEqual(rb.Values, b.Values) {
+			t.Errorf("Failed: expected baseline %+v, recieved %+v, %v", b, rb, err)
+		}
+	}
+}
+
+func TestFileDBRecoversZeroWeight(t *testing.T) {
+	type testCase struct {
+		name    string
+		recover func(fdb *FileDB) *FileDB
+	}
+	cases := []testCase{
+		testCase{name: "log", recover: func(fdb *FileDB) *FileDB { return reopen(t, fdb) }},
+		testCase{name: "snapshot", recover: func(fdb *FileDB) *FileDB {
+			if err := fdb.Close(); err != nil {
+				t.Fatal(err)
+			}
+			recovered, err := GetFileDatastore(fdb.dir, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return recovered
+		}},
+	}
+	for _, c := range cases {
+		fdb := fillFileDB(t, tempDir(t))
+		fdb.UpdateSentiment(SentimentUpdate{Category: "fear", Count: 1, Weight: weight(0), At: time.Now()})
+		expected := fdb.db.Sentiments["fear"]
+		recovered := c.recover(fdb)
+		assertRecovered(t, fdb, recovered)
+		if s := recovered.db.Sentiments["fear"]; s != expected || s.TextCount != 1 || s.WeightedCount != 0 {
+			t.Errorf("Failed for the %v: expected fear %v, recieved %v", c.name, expected, s)
+		}
+		if recovered.db.TotalWeight != fdb.db.TotalWeight {
+			t.Errorf("Failed for the %v: expected TotalWeight %v, recieved %v", c.name, fdb.db.TotalWeight,
+				recovered.db.TotalWeight)
+		}
+		recovered.Close()
+	}
+}
+
+func TestFileDBPing(t *testing.T) {
+	dir := tempDir(t)
+	fdb := fillFileDB(t, dir)
+	if err := fdb.Ping(); err != nil {
+		t.Errorf("Failed: expected no error, recieved %v", err)
+	}
+	os.RemoveAll(dir)
+	if err := fdb.Ping(); err == nil {
+		t.Errorf("Failed: expected an error once the data directory is removed")
+	}
+	fdb.Close()
+	if err := fdb.Ping(); err == nil {
+		t.Errorf("Failed: expected an error once the FileDB is closed")
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+/*
+instrumented offers a DataStore that records the latency and the errors of the operations of another DataStore.
+*/
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"io"
+	"time"
+)
+
+var (
+	opDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "sentiment_datastore_operation_duration_seconds",
+		Help: "Latency of the DataStore operations.",
+		// The in-memory operations take microseconds, the buckets range from 100µs to 6.5s.
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"operation"})
+	opErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentiment_datastore_operation_errors_total",
+		Help: "Number of the DataStore operations that returned an error.",
+	}, []string{"operation"})
+)
+
+// InstrumentedDB wraps a DataStore, and records the latency and the errors of its operations.
+// It is Observable and an io.Closer if the wrapped DataStore is, and it is always a Pinger.
+type InstrumentedDB struct {
+	db DataStore
+}
+
+// Instrument returns an InstrumentedDB that wraps the supplied DataStore.
+func Instrument(db DataStore) *InstrumentedDB {
+	return &InstrumentedDB{db: db}
+}
+
+// record records the latency of an operation that started at the supplied time, and its error, if any.
+func record(op string, start time.Time, err error) {
+	opDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		opErrors.WithLabelValues(op).Inc()
+	}
+}
+
+// InsertText is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) InsertText(t Text) (Text, error) {
+	start := time.Now()
+	txt, err := idb.db.InsertText(t)
+	record("insertText", start, err)
+	return txt, err
+}
+
+// FetchText is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchText(id ID) (Text, error) {
+	start := time.Now()
+	txt, err := idb.db.FetchText(id)
+	record("fetchText", start, err)
+	return txt, err
+}
+
+// FetchTexts is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchTexts(q TextQuery) (TextPage, error) {
+	start := time.Now()
+	page, err := idb.db.FetchTexts(q)
+	record("fetchTexts", start, err)
+	return page, err
+}
+
+// UpdateSentiment is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) UpdateSentiment(u SentimentUpdate) (map[Category]Sentiment, error) {
+	start := time.Now()
+	sents, err := idb.db.UpdateSentiment(u)
+	record("updateSentiment", start, err)
+	return sents, err
+}
+
+// FetchSentiments is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchSentiments(comm Community) (map[Category]Sentiment, error) {
+	start := time.Now()
+	sents, err := idb.db.FetchSentiments(comm)
+	record("fetchSentiments", start, err)
+	return sents, err
+}
+
+// FetchCategorySentiments is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchCategorySentiments(comm Community, catg string) (map[Category]Sentiment, error) {
+	start := time.Now()
+	sents, err := idb.db.FetchCategorySentiments(comm, catg)
+	record("fetchCategorySentiments", start, err)
+	return sents, err
+}
+
+// FetchLanguageSentiments is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchLanguageSentiments(comm Community) (map[string]map[Category]Sentiment, error) {
+	start := time.Now()
+	sents, err := idb.db.FetchLanguageSentiments(comm)
+	record("fetchLanguageSentiments", start, err)
+	return sents, err
+}
+
+// FetchCommunities is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchCommunities() ([]Community, error) {
+	start := time.Now()
+	comms, err := idb.db.FetchCommunities()
+	record("fetchCommunities", start, err)
+	return comms, err
+}
+
+// FetchTimeSeries is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchTimeSeries(q SeriesQuery) ([]SeriesBucket, error) {
+	start := time.Now()
+	series, err := idb.db.FetchTimeSeries(q)
+	record("fetchTimeSeries", start, err)
+	return series, err
+}
+
+// FreezeBaseline is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FreezeBaseline(w BaselineWindow) (Baseline, error) {
+	start := time.Now()
+	b, err := idb.db.FreezeBaseline(w)
+	record("freezeBaseline", start, err)
+	return b, err
+}
+
+// FetchBaseline is exposed by DataStore interface. InstrumentedDB implements this method.
+func (idb *InstrumentedDB) FetchBaseline(comm Community) (Baseline, error) {
+	start := time.Now()
+	b, err := idb.db.FetchBaseline(comm)
+	record("fetchBaseline", start, err)
+	return b, err
+}
+
+// Ping is exposed by Pinger interface. InstrumentedDB implements this method. If the wrapped DataStore is not
+// a Pinger, it is pinged by fetching its communities.
+func (idb *InstrumentedDB) Ping() error {
+	start := time.Now()
+	var err error
+	if p, ok := idb.db.(Pinger); ok {
+		err = p.Ping()
+	} else {
+		_, err = idb.db.FetchCommunities()
+	}
+	record("ping", start, err)
+	return err
+}
+
+// Observe is exposed by Observable interface. InstrumentedDB implements this method, if the wrapped DataStore does.
+func (idb *InstrumentedDB) Observe(observer func(SentimentChange)) {
+	if o, ok := idb.db.(Observable); ok {
+		o.Observe(observer)
+	}
+}
+
+// Close closes the wrapped DataStore, if it is an io.Closer.
+func (idb *InstrumentedDB) Close() error {
+	if c, ok := idb.db.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -6,16 +6,23 @@ memorydb offers an implementation of the DataStore interface. It exposes an in-m
 
 import (
 	"fmt"
-	"github.com/coderafting/panas-go/pkg/sentiment"
 	"github.com/coderafting/sentiment-analysis/internal/utils"
-	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MemoryDB indicates an in-memory database.
 type MemoryDB struct {
 	mux sync.Mutex
 	db  Data
+	// order holds the IDs of the texts sorted by their Seq, it serves the pagination of texts.
+	order   []ID
+	textSeq uint64
+	// observers are called with every SentimentChange.
+	observers []func(SentimentChange)
 }
 
 // GetDatastore instantiates a DataStore.
@@ -25,70 +32,466 @@ func GetDatastore() DataStore {
 }
 
 // InsertText is exposed by DataStore interface. MemoryDB implements this method.
-func (mdb *MemoryDB) InsertText(t string) (Text, error) {
-	// No locking needed here, every insert is a unique insert
+// The ID and the Seq of the supplied text are assigned by the MemoryDB.
+// A text without a community is stored in the DefaultCommunity, and a text without a language in the DefaultLang.
+func (mdb *MemoryDB) InsertText(t Text) (Text, error) {
+	// Every insert is a unique insert, but the map itself is shared by the concurrent writers.
 	id := ID(utils.GenerateUUID())
-	txt := Text{ID: id, TextString: t}
-	mdb.db.Texts[id] = txt
+	if t.Community == "" {
+		t.Community = DefaultCommunity
+	}
+	if t.Lang == "" {
+		t.Lang = DefaultLang
+	}
+	mdb.mux.Lock()
+	t.ID = id
+	t.Seq = mdb.textSeq + 1
+	mdb.putText(t)
 	inserted := mdb.db.Texts[id]
-	if inserted != txt {
-		return txt, fmt.Errorf("Failed to insert key: %v, with val: %v", id, t)
+	mdb.mux.Unlock()
+	if inserted.ID != t.ID || inserted.Seq != t.Seq {
+		return t, fmt.Errorf("Failed to insert key: %v, with val: %v", id, t.TextString)
+	}
+	return t, nil
+}
+
+// putText stores a text whose Seq is newer than the Seq of all the stored texts. The caller must hold the mux.
+func (mdb *MemoryDB) putText(txt Text) {
+	mdb.db.Texts[txt.ID] = txt
+	mdb.order = append(mdb.order, txt.ID)
+	mdb.textSeq = txt.Seq
+}
+
+// reindex rebuilds the insertion order of the texts, after the texts have been loaded in bulk.
+func (mdb *MemoryDB) reindex() {
+	mdb.order = make([]ID, 0, len(mdb.db.Texts))
+	mdb.textSeq = 0
+	for id, txt := range mdb.db.Texts {
+		mdb.order = append(mdb.order, id)
+		if txt.Seq > mdb.textSeq {
+			mdb.textSeq = txt.Seq
+		}
+	}
+	sort.Slice(mdb.order, func(i, j int) bool {
+		return mdb.db.Texts[mdb.order[i]].Seq < mdb.db.Texts[mdb.order[j]].Seq
+	})
+}
+
+// FetchText returns the text with the supplied ID.
+func (mdb *MemoryDB) FetchText(id ID) (Text, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	txt, ok := mdb.db.Texts[id]
+	if !ok {
+		return txt, fmt.Errorf("Text %v doesn't exist: %w", id, ErrTextNotFound)
 	}
 	return txt, nil
 }
 
-// FetchSentiments returns the sentiment details of all the available categories.
-func (mdb *MemoryDB) FetchSentiments() (map[Category]Sentiment, error) {
-	return mdb.db.Sentiments, nil
+// FetchTexts returns a page of the texts that match the query, in their insertion order.
+// A non-positive Limit returns all the matching texts.
+func (mdb *MemoryDB) FetchTexts(q TextQuery) (TextPage, error) {
+	page := TextPage{Texts: []Text{}}
+	var after uint64
+	if q.Cursor != "" {
+		var err error
+		after, err = strconv.ParseUint(q.Cursor, 10, 64)
+		if err != nil {
+			return page, fmt.Errorf("Cursor %v can not be decoded: %w", q.Cursor, ErrInvalidCursor)
+		}
+	}
+	contains := strings.ToLower(q.Contains)
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	start := sort.Search(len(mdb.order), func(i int) bool {
+		return mdb.db.Texts[mdb.order[i]].Seq > after
+	})
+	for i := start; i < len(mdb.order); i++ {
+		txt := mdb.db.Texts[mdb.order[i]]
+		if q.Category != "" && !txt.HasCategory(Category(q.Category)) {
+			continue
+		}
+		if q.Community != "" && txt.Community != q.Community {
+			continue
+		}
+		if q.Lang != "" && txt.Lang != q.Lang {
+			continue
+		}
+		if contains != "" && !strings.Contains(strings.ToLower(txt.TextString), contains) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Texts) == q.Limit {
+			page.NextCursor = strconv.FormatUint(page.Texts[len(page.Texts)-1].Seq, 10)
+			break
+		}
+		page.Texts = append(page.Texts, txt)
+	}
+	return page, nil
 }
 
-// FetchCategorySentiments returns the Sentiment details of the supplied category.
-func (mdb *MemoryDB) FetchCategorySentiments(catg string) (map[Category]Sentiment, error) {
-	sents := mdb.db.Sentiments[Category(catg)]
-	if sentiment.CategoriesMap[catg] != true {
-		err := fmt.Errorf("Category %v doesn't exist", catg)
-		return map[Category]Sentiment{Category(catg): sents}, err
+// FetchSentiments returns the sentiment details of all the available categories, within the supplied community.
+// An empty community selects the sentiments of all the communities.
+func (mdb *MemoryDB) FetchSentiments(comm Community) (map[Category]Sentiment, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	sents := mdb.db.Sentiments
+	if comm != "" {
+		cd, ok := mdb.db.Communities[comm]
+		if !ok {
+			return map[Category]Sentiment{}, fmt.Errorf("Community %v doesn't exist: %w", comm, ErrUnknownCommunity)
+		}
+		sents = cd.Sentiments
 	}
-	return map[Category]Sentiment{Category(catg): sents}, nil
+	return copySentiments(sents), nil
+}
+
+// FetchCategorySentiments returns the Sentiment details of the supplied category, within the supplied community.
+// An empty community selects the sentiments of all the communities. A category without texts has a zero Sentiment.
+func (mdb *MemoryDB) FetchCategorySentiments(comm Community, catg string) (map[Category]Sentiment, error) {
+	sents, err := mdb.FetchSentiments(comm)
+	return map[Category]Sentiment{Category(catg): sents[Category(catg)]}, err
+}
+
+// FetchLanguageSentiments returns the sentiment details of all the available categories of every language,
+// within the supplied community. An empty community selects the sentiments of all the communities.
+func (mdb *MemoryDB) FetchLanguageSentiments(comm Community) (map[string]map[Category]Sentiment, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	langs := mdb.db.Languages
+	if comm != "" {
+		cd, ok := mdb.db.Communities[comm]
+		if !ok {
+			return map[string]map[Category]Sentiment{}, fmt.Errorf("Community %v doesn't exist: %w", comm, ErrUnknownCommunity)
+		}
+		langs = cd.Languages
+	}
+	sents := map[string]map[Category]Sentiment{}
+	for lang, ld := range langs {
+		sents[lang] = copySentiments(ld.Sentiments)
+	}
+	return sents, nil
+}
+
+// FetchCommunities returns the communities in which some texts have been received, sorted by name.
+func (mdb *MemoryDB) FetchCommunities() ([]Community, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	comms := []Community{}
+	for c := range mdb.db.Communities {
+		comms = append(comms, c)
+	}
+	sort.Slice(comms, func(i, j int) bool { return comms[i] < comms[j] })
+	return comms, nil
 }
 
 // UpdateSentiment updates the sentiment value of a supplied category as well as for other categories,
-// based on the new texts count.
-func (mdb *MemoryDB) UpdateSentiment(catg string, tcount int) (map[Category]Sentiment, error) {
+// based on the new texts count, both within the community of the update and across all the communities.
+// The sentiments of the language of the update are updated the same way.
+// The texts count is also recorded in the history, at the time of the update.
+// It returns the updated sentiment of the category within the community.
+func (mdb *MemoryDB) UpdateSentiment(u SentimentUpdate) (map[Category]Sentiment, error) {
+	if u.Community == "" {
+		u.Community = DefaultCommunity
+	}
+	if u.Lang == "" {
+		u.Lang = DefaultLang
+	}
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	if mdb.db.Communities == nil {
+		mdb.db.Communities = map[Community]CommunityData{}
+	}
+	cd, ok := mdb.db.Communities[u.Community]
+	if !ok {
+		cd = CommunityData{Sentiments: map[Category]Sentiment{}}
+	}
+	mdb.db.History = recordHistory(mdb.db.History, u)
+	cd.History = recordHistory(cd.History, u)
+	_, err := updateSentiments(mdb.db.Sentiments, &mdb.db.TotalTexts, &mdb.db.TotalWeight, u)
+	if err != nil {
+		return map[Category]Sentiment{}, err
+	}
+	if mdb.db.Languages, err = updateLanguage(mdb.db.Languages, u); err != nil {
+		return map[Category]Sentiment{}, err
+	}
+	if cd.Languages, err = updateLanguage(cd.Languages, u); err != nil {
+		return map[Category]Sentiment{}, err
+	}
+	sentDetails, err := updateSentiments(cd.Sentiments, &cd.TotalTexts, &cd.TotalWeight, u)
+	mdb.db.Communities[u.Community] = cd
+	if err == nil {
+		mdb.notify(SentimentChange{
+			Community:            u.Community,
+			Category:             Category(u.Category),
+			Sentiment:            mdb.db.Sentiments[Category(u.Category)],
+			TotalTexts:           mdb.db.TotalTexts,
+			TotalWeight:          mdb.db.TotalWeight,
+			CommunitySentiment:   sentDetails,
+			CommunityTotalTexts:  cd.TotalTexts,
+			CommunityTotalWeight: cd.TotalWeight,
+			At:                   u.At,
+		})
+	}
+	return map[Category]Sentiment{Category(u.Category): sentDetails}, err
+}
+
+// Ping is exposed by Pinger interface. MemoryDB implements this method.
+// It only returns once the data is not locked by another operation.
+func (mdb *MemoryDB) Ping() error {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	return nil
+}
+
+// Observe is exposed by Observable interface. MemoryDB implements this method.
+func (mdb *MemoryDB) Observe(observer func(SentimentChange)) {
 	mdb.mux.Lock()
-	catgSentiment := mdb.db.Sentiments[Category(catg)]
-	// get the current counts
-	oldCount := catgSentiment.TextCount
-	oldTotal := mdb.db.TotalTexts
+	defer mdb.mux.Unlock()
+	mdb.observers = append(mdb.observers, observer)
+}
+
+// notify calls the observers with a SentimentChange. The caller must hold the mux.
+func (mdb *MemoryDB) notify(c SentimentChange) {
+	for _, observer := range mdb.observers {
+		observer(c)
+	}
+}
+
+func copySentiments(sents map[Category]Sentiment) map[Category]Sentiment {
+	copied := map[Category]Sentiment{}
+	for k, v := range sents {
+		copied[k] = v
+	}
+	return copied
+}
+
+// updateSentiments adds the texts count and the weight of the update to the sentiments, to the total texts count
+// and to the total weight, and returns the updated sentiment of the category of the update.
+func updateSentiments(sents map[Category]Sentiment, total *int, totalWeight *float64, u SentimentUpdate) (Sentiment, error) {
+	catgSentiment := sents[Category(u.Category)]
 	// update the counts
-	newCount := oldCount + tcount
-	newTotal := oldTotal + tcount
-	catgSentiment.TextCount = newCount
-	mdb.db.TotalTexts = newTotal
+	newCount := catgSentiment.TextCount + u.Count
+	newWeighted := catgSentiment.WeightedCount + u.weight()
+	*total += u.Count
+	*totalWeight += u.weight()
 	// update the sentiment of the category
-	newSentimentVal, err := sentiment.CategoryAggregate(newCount, newTotal)
-	if err != nil {
-		log.Println("Error while computing aggregate sentiment.")
+	newSentimentVal := weightedAggregate(newWeighted, *totalWeight)
+	sentDetails := Sentiment{Value: newSentimentVal, TextCount: newCount, WeightedCount: newWeighted}
+	// Update all other sentiments based on the change in the total weight
+	for k, v := range sents {
+		if k != Category(u.Category) {
+			v.Value = weightedAggregate(v.WeightedCount, *totalWeight)
+			sents[k] = v
+		}
 	}
-	sentDetails := Sentiment{Value: newSentimentVal, TextCount: newCount}
-	catgSentmnt := map[Category]Sentiment{Category(catg): sentDetails}
-	mdb.db.Sentiments[Category(catg)] = sentDetails
-	// Update all other sentiments based on the change in the total texts count
-	allSents, err := mdb.FetchSentiments()
-	if err != nil {
-		log.Println("Error while fetching all sentiments, in the process of updating sentiments.")
+	sents[Category(u.Category)] = sentDetails
+	if sents[Category(u.Category)].Value != newSentimentVal {
+		return sentDetails, fmt.Errorf("Failed to update the sentiment of category: %v, with additional texts count of: %v", u.Category, u.Count)
 	}
-	for k, v := range allSents {
-		if k != Category(catg) {
-			newVal := (v.Value * float64(oldTotal)) / float64(newTotal)
-			mdb.db.Sentiments[k] = Sentiment{Value: newVal, TextCount: v.TextCount}
+	return sentDetails, nil
+}
+
+// updateLanguage updates the sentiments of the language of the update, and returns the languages.
+func updateLanguage(langs map[string]LanguageData, u SentimentUpdate) (map[string]LanguageData, error) {
+	if langs == nil {
+		langs = map[string]LanguageData{}
+	}
+	ld, ok := langs[u.Lang]
+	if !ok {
+		ld = LanguageData{Sentiments: map[Category]Sentiment{}}
+	}
+	_, err := updateSentiments(ld.Sentiments, &ld.TotalTexts, &ld.TotalWeight, u)
+	langs[u.Lang] = ld
+	return langs, err
+}
+
+// weightedAggregate returns the aggregate sentiment value of a category, i.e. the share of the sum of the weights
+// of its texts in the total weight, the way sentiment.CategoryAggregate does from the count of its texts.
+// It ranges from 0 to 1, and it is 0 if the total weight is 0, i.e. if no text contributes.
+func weightedAggregate(weightedCount float64, totalWeight float64) float64 {
+	if totalWeight == 0 {
+		return 0
+	}
+	return weightedCount / totalWeight
+}
+
+// recordHistory adds the texts count of the update to the history bucket of its time, and returns the history.
+func recordHistory(history map[int64]HistoryBucket, u SentimentUpdate) map[int64]HistoryBucket {
+	if history == nil {
+		history = map[int64]HistoryBucket{}
+	}
+	key := u.At.Truncate(HistoryResolution).Unix()
+	bucket, ok := history[key]
+	if !ok {
+		bucket = HistoryBucket{TextCounts: map[Category]int{}, WeightedCounts: map[Category]float64{}}
+	}
+	bucket.TextCounts[Category(u.Category)] += u.Count
+	bucket.WeightedCounts[Category(u.Category)] += u.weight()
+	bucket.TotalTexts += u.Count
+	bucket.TotalWeight += u.weight()
+	history[key] = bucket
+	return history
+}
+
+// FetchTimeSeries aggregates the history into buckets of the supplied width, and computes the sentiments of
+// every bucket. Only the buckets in which some texts were received are returned, sorted by their Start.
+func (mdb *MemoryDB) FetchTimeSeries(q SeriesQuery) ([]SeriesBucket, error) {
+	series := []SeriesBucket{}
+	width, ok := q.Bucket.Duration()
+	if !ok {
+		return series, fmt.Errorf("Bucket %v is not one of minute, hour, day: %w", q.Bucket, ErrInvalidBucket)
+	}
+	from := q.From.Truncate(width).Unix()
+	// The bucket that holds To is returned, unless To is its start.
+	to := q.To.Truncate(width)
+	if to.Before(q.To) {
+		to = to.Add(width)
+	}
+	step := int64(width / time.Second)
+	aggregated := map[int64]HistoryBucket{}
+	mdb.mux.Lock()
+	history := mdb.db.History
+	if q.Community != "" {
+		cd, ok := mdb.db.Communities[q.Community]
+		if !ok {
+			mdb.mux.Unlock()
+			return series, fmt.Errorf("Community %v doesn't exist: %w", q.Community, ErrUnknownCommunity)
 		}
+		history = cd.History
+	}
+	for key, hb := range history {
+		if key < from || key >= to.Unix() {
+			continue
+		}
+		start := key - ((key%step)+step)%step
+		agg, ok := aggregated[start]
+		if !ok {
+			agg = HistoryBucket{TextCounts: map[Category]int{}, WeightedCounts: map[Category]float64{}}
+		}
+		for c, n := range hb.TextCounts {
+			agg.TextCounts[c] += n
+		}
+		for c, w := range hb.WeightedCounts {
+			agg.WeightedCounts[c] += w
+		}
+		agg.TotalTexts += hb.TotalTexts
+		agg.TotalWeight += hb.TotalWeight
+		aggregated[start] = agg
 	}
 	mdb.mux.Unlock()
-	// Check if the update is successful, and return a response accordingly.
-	updated := mdb.db.Sentiments[Category(catg)].Value
-	if updated != newSentimentVal {
-		return catgSentmnt, fmt.Errorf("Failed to update the sentiment of category: %v, with additional texts count of: %v", catg, tcount)
+	for start, agg := range aggregated {
+		sb := SeriesBucket{Start: time.Unix(start, 0).UTC(), Sentiments: map[Category]Sentiment{}, TotalTexts: agg.TotalTexts,
+			TotalWeight: agg.TotalWeight}
+		for c, n := range agg.TextCounts {
+			if q.Category != "" && c != Category(q.Category) {
+				continue
+			}
+			val := weightedAggregate(agg.WeightedCounts[c], agg.TotalWeight)
+			sb.Sentiments[c] = Sentiment{Value: val, TextCount: n, WeightedCount: agg.WeightedCounts[c]}
+		}
+		series = append(series, sb)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Start.Before(series[j].Start)
+	})
+	return series, nil
+}
+
+// FreezeBaseline computes the sentiment values of the categories within the supplied window from the history,
+// and stores them as the baseline. It replaces the existing baseline, if any.
+// When a Closed window is not over, ErrOpenWindow is returned along with the From and To of the window.
+func (mdb *MemoryDB) FreezeBaseline(w BaselineWindow) (Baseline, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	history := mdb.db.History
+	if w.Community != "" {
+		cd, ok := mdb.db.Communities[w.Community]
+		if !ok {
+			return Baseline{}, fmt.Errorf("Community %v doesn't exist: %w", w.Community, ErrUnknownCommunity)
+		}
+		history = cd.History
+	}
+	from, to := w.From, w.To
+	if w.FirstDays > 0 {
+		first, ok := firstHistoryKey(history)
+		if !ok {
+			return Baseline{}, fmt.Errorf("The history is empty: %w", ErrInvalidWindow)
+		}
+		from = time.Unix(first, 0).UTC()
+		to = from.AddDate(0, 0, w.FirstDays)
+	}
+	if !from.Before(to) {
+		return Baseline{}, fmt.Errorf("From %v is not before To %v: %w", from, to, ErrInvalidWindow)
+	}
+	if w.Closed && to.After(time.Now()) {
+		return Baseline{Community: w.Community, From: from, To: to}, fmt.Errorf("The window ends at %v: %w", to, ErrOpenWindow)
+	}
+	b := Baseline{Community: w.Community, From: from, To: to, Values: map[Category]float64{}}
+	weighted := map[Category]float64{}
+	for key, hb := range history {
+		if key < from.Unix() || key >= to.Unix() {
+			continue
+		}
+		for c, w := range hb.WeightedCounts {
+			weighted[c] += w
+		}
+		b.TotalTexts += hb.TotalTexts
+		b.TotalWeight += hb.TotalWeight
+	}
+	if b.TotalTexts == 0 {
+		return Baseline{}, fmt.Errorf("No texts were received from %v to %v: %w", from, to, ErrInvalidWindow)
+	}
+	for c, w := range weighted {
+		b.Values[c] = weightedAggregate(w, b.TotalWeight)
+	}
+	mdb.setBaseline(b)
+	return b, nil
+}
+
+// setBaseline stores the baseline of its community. The caller must hold the mux.
+func (mdb *MemoryDB) setBaseline(b Baseline) {
+	if b.Community == "" {
+		mdb.db.Baseline = &b
+		return
+	}
+	if mdb.db.Communities == nil {
+		mdb.db.Communities = map[Community]CommunityData{}
+	}
+	cd, ok := mdb.db.Communities[b.Community]
+	if !ok {
+		cd = CommunityData{Sentiments: map[Category]Sentiment{}}
+	}
+	cd.Baseline = &b
+	mdb.db.Communities[b.Community] = cd
+}
+
+// firstHistoryKey returns the key of the oldest bucket of a history.
+func firstHistoryKey(history map[int64]HistoryBucket) (int64, bool) {
+	var first int64
+	found := false
+	for key := range history {
+		if !found || key < first {
+			first, found = key, true
+		}
+	}
+	return first, found
+}
+
+// FetchBaseline returns the baseline of the supplied community, or ErrNoBaseline if it has not been frozen yet.
+// An empty community selects the baseline of all the communities.
+func (mdb *MemoryDB) FetchBaseline(comm Community) (Baseline, error) {
+	mdb.mux.Lock()
+	defer mdb.mux.Unlock()
+	b := mdb.db.Baseline
+	if comm != "" {
+		cd, ok := mdb.db.Communities[comm]
+		if !ok {
+			return Baseline{}, fmt.Errorf("Community %v doesn't exist: %w", comm, ErrUnknownCommunity)
+		}
+		b = cd.Baseline
+	}
+	if b == nil {
+		return Baseline{}, ErrNoBaseline
 	}
-	return catgSentmnt, nil
+	return *b, nil
 }
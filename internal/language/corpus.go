@@ -0,0 +1,85 @@
+package language
+
+/*
+corpus holds the sample texts from which the trigram profiles of the supported languages are built.
+The samples are short, informal sentences, close to the texts received by the service.
+*/
+
+var corpora = map[string]string{
+	English: `I am so happy today, it was a great day with my friends.
+I feel tired and sleepy after the long week at work.
+I am not sure what to do now, but I think it will be fine.
+Feeling really sad and lonely tonight, nobody called me.
+I am scared of the exam tomorrow, I did not study enough.
+This is the best thing that happened to me this year.
+I am angry because they cancelled the flight again.
+We are going to the beach this weekend, I cannot wait!
+I feel calm and relaxed when I read a good book.
+Why is everyone so rude on the internet these days?
+I was surprised to see how many people came to the party.
+My mother always says that I should sleep more.
+I am proud of my team, we won the match last night.
+It is raining again and I have to walk to the office.
+I feel guilty that I forgot her birthday.
+Honestly, I am a bit nervous about the new job.
+Thank you for your help, you are the best.
+I would like to know what you think about the movie.
+They have been waiting for the results since the morning.
+I am feeling much better now, thanks for asking.
+There is nothing better than a hot coffee on a cold day.
+The weather is beautiful and I want to go outside.
+I don't know why, but I feel a little bit down.
+Everything is going well and I am excited about the future.`,
+	Spanish: `Estoy muy feliz hoy, fue un gran día con mis amigos.
+Me siento cansado y con sueño después de la semana tan larga en el trabajo.
+No estoy seguro de qué hacer ahora, pero creo que todo va a salir bien.
+Me siento muy triste y sola esta noche, nadie me llamó.
+Tengo miedo del examen de mañana, no estudié lo suficiente.
+Esto es lo mejor que me ha pasado este año.
+Estoy enojado porque cancelaron el vuelo otra vez.
+Vamos a la playa este fin de semana, ¡no puedo esperar!
+Me siento tranquila y relajada cuando leo un buen libro.
+¿Por qué todo el mundo es tan grosero en internet estos días?
+Me sorprendió ver cuánta gente vino a la fiesta.
+Mi madre siempre dice que debería dormir más.
+Estoy orgulloso de mi equipo, ganamos el partido anoche.
+Está lloviendo otra vez y tengo que caminar hasta la oficina.
+Me siento culpable porque olvidé su cumpleaños.
+La verdad, estoy un poco nervioso por el nuevo trabajo.
+Gracias por tu ayuda, eres el mejor.
+Me gustaría saber qué piensas de la película.
+Ellos han estado esperando los resultados desde la mañana.
+Ya me siento mucho mejor, gracias por preguntar.
+No hay nada mejor que un café caliente en un día frío.
+El tiempo está precioso y quiero salir a la calle.
+No sé por qué, pero me siento un poco desanimado.
+Todo va bien y estoy ilusionada con el futuro.
+Yo soy así, y no voy a cambiar por nadie.
+Hoy estoy muy contento y también un poco asustado.`,
+	Portuguese: `Estou muito feliz hoje, foi um ótimo dia com meus amigos.
+Eu me sinto cansado e com sono depois da semana tão longa no trabalho.
+Não tenho certeza do que fazer agora, mas acho que vai dar tudo certo.
+Estou me sentindo muito triste e sozinha esta noite, ninguém me ligou.
+Tenho medo da prova de amanhã, não estudei o suficiente.
+Isso é a melhor coisa que me aconteceu este ano.
+Estou com raiva porque cancelaram o voo de novo.
+Vamos para a praia neste fim de semana, não vejo a hora!
+Eu me sinto calma e relaxada quando leio um bom livro.
+Por que todo mundo é tão grosseiro na internet hoje em dia?
+Fiquei surpreso ao ver quantas pessoas vieram para a festa.
+Minha mãe sempre diz que eu deveria dormir mais.
+Estou orgulhoso do meu time, ganhamos o jogo ontem à noite.
+Está chovendo de novo e eu tenho que andar até o escritório.
+Eu me sinto culpado porque esqueci o aniversário dela.
+Na verdade, estou um pouco nervoso com o novo emprego.
+Obrigado pela sua ajuda, você é o melhor.
+Eu gostaria de saber o que você acha do filme.
+Eles estão esperando os resultados desde a manhã.
+Já estou me sentindo muito melhor, obrigada por perguntar.
+Não há nada melhor do que um café quente num dia frio.
+O tempo está lindo e eu quero sair de casa.
+Não sei por quê, mas estou um pouco desanimado.
+Tudo está indo bem e eu estou animada com o futuro.
+Eu sou assim, e não vou mudar por ninguém.
+Hoje estou muito contente e também um pouco assustado.`,
+}
@@ -0,0 +1,129 @@
+// Package language detects the language of a text, offline, with a naive Bayes classifier over the character
+// trigrams of the words. The trigram profiles of the supported languages are built from the built-in samples.
+package language
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The supported languages, identified by their ISO 639-1 codes.
+const (
+	English    = "en"
+	Spanish    = "es"
+	Portuguese = "pt"
+)
+
+// ErrUnsupportedLanguage is returned when a language is not one of the supported languages.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// smoothing is the count added to every trigram of a profile, so that an unseen trigram doesn't rule a language out.
+const smoothing = 0.5
+
+// profile holds the trigram counts of a language.
+type profile struct {
+	counts map[string]int
+	total  int
+}
+
+// profiles holds the profiles of the supported languages, and vocabulary is the number of distinct trigrams
+// across all of them.
+var profiles, vocabulary = buildProfiles()
+
+func buildProfiles() (map[string]profile, int) {
+	ps := map[string]profile{}
+	seen := map[string]bool{}
+	for lang, corpus := range corpora {
+		p := profile{counts: map[string]int{}}
+		for _, tg := range trigrams(corpus) {
+			p.counts[tg]++
+			p.total++
+			seen[tg] = true
+		}
+		ps[lang] = p
+	}
+	return ps, len(seen)
+}
+
+// trigrams returns the character trigrams of the words of a text, every word being padded with a space on both
+// sides. The words are lowercased, and split by the characters that are not letters.
+func trigrams(txt string) []string {
+	tgs := []string{}
+	words := strings.FieldsFunc(strings.ToLower(txt), func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, w := range words {
+		runes := []rune(" " + w + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			tgs = append(tgs, string(runes[i:i+3]))
+		}
+	}
+	return tgs
+}
+
+// Supported returns the codes of the supported languages, sorted.
+func Supported() []string {
+	langs := []string{}
+	for lang := range profiles {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// IsSupported checks if the language is one of the supported languages.
+func IsSupported(lang string) bool {
+	_, ok := profiles[lang]
+	return ok
+}
+
+// Detector detects the language of a text, among a set of the supported languages.
+type Detector struct {
+	langs []string
+}
+
+// NewDetector returns a Detector of the supplied languages, or of all the supported languages if none is supplied.
+// The first language is the fallback of the texts that hold no letters.
+func NewDetector(langs ...string) (Detector, error) {
+	if len(langs) == 0 {
+		langs = append([]string{English}, Spanish, Portuguese)
+	}
+	for _, lang := range langs {
+		if !IsSupported(lang) {
+			return Detector{}, fmt.Errorf("Language %q is not one of %v: %w", lang, Supported(), ErrUnsupportedLanguage)
+		}
+	}
+	return Detector{langs: append([]string{}, langs...)}, nil
+}
+
+// Languages returns the languages of the Detector.
+func (d Detector) Languages() []string {
+	return append([]string{}, d.langs...)
+}
+
+// Detect returns the most likely language of the text, i.e. the language whose profile gives the highest
+// log-likelihood to the trigrams of the text.
+func (d Detector) Detect(txt string) string {
+	if len(d.langs) == 0 {
+		return English
+	}
+	tgs := trigrams(txt)
+	best, bestScore := d.langs[0], math.Inf(-1)
+	if len(tgs) == 0 {
+		return best
+	}
+	for _, lang := range d.langs {
+		p := profiles[lang]
+		denom := math.Log(float64(p.total) + smoothing*float64(vocabulary))
+		score := 0.0
+		for _, tg := range tgs {
+			score += math.Log(float64(p.counts[tg])+smoothing) - denom
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
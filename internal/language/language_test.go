@@ -0,0 +1,52 @@
+package language
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	d, err := NewDetector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"I am so happy today":              English,
+		"I feel happy":                     English,
+		"I am scared of the dark":          English,
+		"Feeling tired, going to bed":      English,
+		"I am not sad, just tired":         English,
+		"Estoy muy cansado hoy":            Spanish,
+		"Me siento feliz":                  Spanish,
+		"Estoy triste porque no vino":      Spanish,
+		"Yo tengo miedo":                   Spanish,
+		"¡Qué alegría, ganamos!":           Spanish,
+		"Estou muito cansado hoje":         Portuguese,
+		"Eu me sinto feliz":                Portuguese,
+		"Estou triste porque ele não veio": Portuguese,
+		"Eu tenho medo":                    Portuguese,
+		"Que alegria, ganhamos o jogo!":    Portuguese,
+		"😱":                                English,
+	}
+	for txt, expected := range cases {
+		if lang := d.Detect(txt); lang != expected {
+			t.Errorf("Detect failed for %q, expected %v, got %v", txt, expected, lang)
+		}
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	d, err := NewDetector(Spanish, Portuguese)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lang := d.Detect("I am happy"); lang != Spanish && lang != Portuguese {
+		t.Errorf("Detect failed, expected one of the languages of the detector, got %v", lang)
+	}
+	if lang := d.Detect(":)"); lang != Spanish {
+		t.Errorf("Detect failed, expected the fallback %v, got %v", Spanish, lang)
+	}
+	if _, err := NewDetector("fr"); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("NewDetector failed, expected %v, got %v", ErrUnsupportedLanguage, err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package logging offers a leveled logger that writes every entry as a JSON object on a single line,
+// e.g. {"time":"2020-09-01T10:00:00Z","level":"error","msg":"Error inserting the text","requestID":"host/abc-000001"}.
+// The fields of an entry, such as the ID of the request that carried a text, correlate the entries of
+// the stages of the pipeline.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int32
+
+// The levels, from the least to the most severe. A logger writes the entries of its level and above.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+// String returns the name of the level, as it appears in the entries.
+func (l Level) String() string {
+	if l < DebugLevel || l > FatalLevel {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of the supplied name: "debug", "info", "warn", or "error".
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames[:FatalLevel] {
+		if strings.EqualFold(name, n) {
+			return Level(l), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q, expected one of %v", name, levelNames[:FatalLevel])
+}
+
+// Fields are the fields of a log entry, in addition to its time, level and message.
+type Fields map[string]interface{}
+
+// output is the destination of the entries, shared by a Logger and the Loggers derived from it.
+type output struct {
+	mux   sync.Mutex
+	w     io.Writer
+	level int32
+}
+
+// Logger writes the log entries of its level and above, along with its fields.
+type Logger struct {
+	out    *output
+	fields Fields
+}
+
+// New returns a Logger that writes the entries of the supplied level and above to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, level: int32(level)}}
+}
+
+// Default is the Logger used by the functions of the package, it writes to the standard error.
+var Default = New(os.Stderr, InfoLevel)
+
+// With returns a Logger that adds the supplied fields to every entry. It shares the output and the level
+// of the Logger it is derived from.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{out: l.out, fields: merged}
+}
+
+// SetLevel replaces the level of the Logger, and of the Loggers that share its output.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.out.level, int32(level))
+}
+
+// Enabled checks if the entries of the supplied level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return int32(level) >= atomic.LoadInt32(&l.out.level)
+}
+
+// Log writes an entry of the supplied level. Unlike Fatal, it doesn't exit on the FatalLevel.
+func (l *Logger) Log(level Level, msg string, fields ...Fields) {
+	l.log(level, msg, fields)
+}
+
+// Debug writes an entry of the DebugLevel.
+func (l *Logger) Debug(msg string, fields ...Fields) {
+	l.log(DebugLevel, msg, fields)
+}
+
+// Info writes an entry of the InfoLevel.
+func (l *Logger) Info(msg string, fields ...Fields) {
+	l.log(InfoLevel, msg, fields)
+}
+
+// Warn writes an entry of the WarnLevel.
+func (l *Logger) Warn(msg string, fields ...Fields) {
+	l.log(WarnLevel, msg, fields)
+}
+
+// Error writes an entry of the ErrorLevel.
+func (l *Logger) Error(msg string, fields ...Fields) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+// Fatal writes an entry of the FatalLevel, whatever the level of the Logger, and exits.
+func (l *Logger) Fatal(msg string, fields ...Fields) {
+	l.log(FatalLevel, msg, fields)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := Fields{}
+	for k, v := range l.fields {
+		all[k] = v
+	}
+	for _, f := range fields {
+		for k, v := range f {
+			all[k] = v
+		}
+	}
+	line := encode(time.Now().UTC(), level, msg, all)
+	l.out.mux.Lock()
+	defer l.out.mux.Unlock()
+	l.out.w.Write(line)
+}
+
+// encode encodes an entry as a line of JSON. The time, the level and the message come first,
+// followed by the fields sorted by their names.
+func encode(t time.Time, level Level, msg string, fields Fields) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	b.Write(encodeValue(t.Format(time.RFC3339Nano)))
+	b.WriteString(`,"level":`)
+	b.Write(encodeValue(level.String()))
+	b.WriteString(`,"msg":`)
+	b.Write(encodeValue(msg))
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b.WriteString(",")
+		b.Write(encodeValue(k))
+		b.WriteString(":")
+		b.Write(encodeValue(fields[k]))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// encodeValue encodes a value as JSON. The errors are encoded as their messages, and the values that can't be
+// encoded as JSON are encoded as their string representations.
+func encodeValue(v interface{}) []byte {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	return encoded
+}
+
+// SetLevel replaces the level of the Default Logger.
+func SetLevel(level Level) {
+	Default.SetLevel(level)
+}
+
+// With returns a Logger derived from the Default Logger, that adds the supplied fields to every entry.
+func With(fields Fields) *Logger {
+	return Default.With(fields)
+}
+
+// Enabled checks if the entries of the supplied level are written by the Default Logger.
+func Enabled(level Level) bool {
+	return Default.Enabled(level)
+}
+
+// Log writes an entry of the supplied level with the Default Logger.
+func Log(level Level, msg string, fields ...Fields) {
+	Default.Log(level, msg, fields...)
+}
+
+// Debug writes an entry of the DebugLevel with the Default Logger.
+func Debug(msg string, fields ...Fields) {
+	Default.Debug(msg, fields...)
+}
+
+// Info writes an entry of the InfoLevel with the Default Logger.
+func Info(msg string, fields ...Fields) {
+	Default.Info(msg, fields...)
+}
+
+// Warn writes an entry of the WarnLevel with the Default Logger.
+func Warn(msg string, fields ...Fields) {
+	Default.Warn(msg, fields...)
+}
+
+// Error writes an entry of the ErrorLevel with the Default Logger.
+func Error(msg string, fields ...Fields) {
+	Default.Error(msg, fields...)
+}
+
+// Fatal writes an entry of the FatalLevel with the Default Logger, and exits.
+func Fatal(msg string, fields ...Fields) {
+	Default.Fatal(msg, fields...)
+}
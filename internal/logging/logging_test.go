@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, InfoLevel)
+	req := l.With(Fields{"requestID": "host/abc-000001"})
+	req.Debug("Text categorized")
+	req.Error("Error inserting the text", Fields{"error": errors.New("disk full"), "categories": []string{"sadness"}})
+	l.SetLevel(DebugLevel)
+	req.Debug("Text categorized", Fields{"requestID": "host/abc-000002"})
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Failed: expected %v entries, recieved %v", 2, b.String())
+	}
+	expected := []string{
+		`","level":"error","msg":"Error inserting the text","categories":["sadness"],"error":"disk full","requestID":"host/abc-000001"}`,
+		`","level":"debug","msg":"Text categorized","requestID":"host/abc-000002"}`,
+	}
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry["time"] == nil {
+			t.Errorf("Failed: expected a JSON entry with a time, recieved %v, %v", line, err)
+		}
+		if !strings.HasPrefix(line, `{"time":"`) || !strings.HasSuffix(line, expected[i]) {
+			t.Errorf("Failed: expected an entry ending with %v, recieved %v", expected[i], line)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	type testCase struct {
+		name     string
+		expected Level
+		valid    bool
+	}
+	cases := []testCase{
+		testCase{name: "debug", expected: DebugLevel, valid: true},
+		testCase{name: "WARN", expected: WarnLevel, valid: true},
+		testCase{name: "error", expected: ErrorLevel, valid: true},
+		testCase{name: "fatal", expected: InfoLevel, valid: false},
+		testCase{name: "verbose", expected: InfoLevel, valid: false},
+	}
+	for _, c := range cases {
+		level, err := ParseLevel(c.name)
+		if level != c.expected || (err == nil) != c.valid {
+			t.Errorf("Failed for %v: expected %v and a valid level %v, recieved %v, %v", c.name, c.expected, c.valid, level, err)
+		}
+	}
+}
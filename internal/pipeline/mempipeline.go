@@ -0,0 +1,369 @@
+package pipeline
+
+/*
+mempipeline offers an implementation of the Pipeline interface. It wires the in-memory partitions
+and the round-robin load-balancing of the two stages of the pipeline.
+*/
+
+import (
+	"context"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stageDuration is the latency of the stages of the pipeline: the admission of a text to a stage-1 partition
+// ("publish"), its categorization ("process"), and the updates of the datastore ("save").
+var stageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "sentiment_pipeline_stage_duration_seconds",
+	Help: "Latency of the stages of the pipeline.",
+	// From 100µs, the stages take well below the default 5ms bucket when the pipeline isn't saturated.
+	Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+}, []string{"stage"})
+
+// MemPipeline indicates an in-memory pipeline, built on the MemPartitions.
+type MemPipeline struct {
+	// counters are accessed atomically, keep them 64-bit aligned at the top of the struct
+	submitted   int64
+	saved       int64
+	pending     int64
+	savedAtStop int64
+	dropped     int64
+	rejected    int64
+	evicted     int64
+	// processing and saving are the numbers of running stage-2 and stage-3 workers.
+	processing int64
+	saving     int64
+	// settings holds the memSettings, they are replaced atomically by Reconfigure.
+	settings           atomic.Value
+	db                 database.DataStore
+	validTextChans     []chan TweetText
+	processedTextChans []chan TweetText
+	// There are two partition-sets (two sets of collection of channels) at the two stages of the pipeline,
+	// therefore, two round-robin states will have to be maintained.
+	vtRoundRobin MemRR
+	ptRoundRobin MemRR
+	mux          sync.RWMutex
+	stopped      bool
+	observers    []func(TweetText)
+	publishers   sync.WaitGroup
+	processors   sync.WaitGroup
+	savers       sync.WaitGroup
+	// quit is closed when Stop gives up on draining, the stage-2 and stage-3 workers exit after their current text.
+	quit chan struct{}
+}
+
+// memSettings are the settings of a MemPipeline that can be replaced while its workers keep running.
+type memSettings struct {
+	admission Admission
+	clf       classifier.Classifier
+	weighting Weighting
+}
+
+// newMemSettings applies the defaults of the zero Admission and the nil Classifier.
+func newMemSettings(adm Admission, clf classifier.Classifier, w Weighting) memSettings {
+	if adm.Policy == "" {
+		adm.Policy = Block
+	}
+	if clf == nil {
+		clf = classifier.Panas{}
+	}
+	return memSettings{admission: adm, clf: clf, weighting: w}
+}
+
+// GetMemPipeline instantiates a MemPipeline, with num partitions of the supplied buffer at each stage,
+// that categorizes the texts with the supplied Classifier, weighs them as per the supplied Weighting, and saves
+// the processed texts to the supplied DataStore. The zero value of Admission indicates the Block policy,
+// and a nil Classifier indicates the Panas classifier.
+func GetMemPipeline(num int, buffer int, adm Admission, clf classifier.Classifier, w Weighting,
+	db database.DataStore) *MemPipeline {
+	p := MemPipeline{
+		db:                 db,
+		validTextChans:     MemPartitions(num, buffer),
+		processedTextChans: MemPartitions(num, buffer),
+		quit:               make(chan struct{}),
+	}
+	p.settings.Store(newMemSettings(adm, clf, w))
+	return &p
+}
+
+// Submit is exposed by Pipeline interface. MemPipeline implements this method.
+// The text is published to a stage-1 partition, selected in a round-robin fashion, from the calling goroutine.
+func (p *MemPipeline) Submit(ctx context.Context, t TweetText) error {
+	p.mux.RLock()
+	if p.stopped {
+		p.mux.RUnlock()
+		return ErrStopped
+	}
+	p.publishers.Add(1)
+	p.mux.RUnlock()
+	defer p.publishers.Done()
+	defer observeStage("publish", time.Now())
+	adm := p.settings.Load().(memSettings).admission
+	partition := p.validTextChans[NextIndex(&p.vtRoundRobin, len(p.validTextChans)-1)]
+	// The fast path, there is space in the partition.
+	select {
+	case partition <- t:
+		p.admitted(t)
+		return nil
+	default:
+	}
+	if adm.Policy == Block {
+		select {
+		case partition <- t:
+			p.admitted(t)
+			return nil
+		case <-ctx.Done():
+			return p.rejectedText(t, ctx.Err())
+		}
+	}
+	timer := time.NewTimer(adm.Timeout)
+	defer timer.Stop()
+	select {
+	case partition <- t:
+		p.admitted(t)
+		return nil
+	case <-ctx.Done():
+		return p.rejectedText(t, ctx.Err())
+	case <-timer.C:
+	}
+	if adm.Policy == DropOldest {
+		return p.evictAndPublish(partition, t)
+	}
+	return p.rejectedText(t, ErrSaturated)
+}
+
+// evictAndPublish evicts the oldest texts of the partition until the supplied text fits in.
+func (p *MemPipeline) evictAndPublish(partition chan TweetText, t TweetText) error {
+	for {
+		select {
+		case partition <- t:
+			p.admitted(t)
+			return nil
+		default:
+		}
+		select {
+		case evicted := <-partition:
+			atomic.AddInt64(&p.evicted, 1)
+			atomic.AddInt64(&p.pending, -1)
+			logText(logging.WarnLevel, "publish", evicted, "Text evicted from a saturated partition", nil)
+		default:
+		}
+	}
+}
+
+func (p *MemPipeline) admitted(t TweetText) {
+	atomic.AddInt64(&p.submitted, 1)
+	atomic.AddInt64(&p.pending, 1)
+	logText(logging.DebugLevel, "publish", t, "Text admitted", nil)
+}
+
+// rejectedText counts a text that was not admitted, and returns the reason.
+func (p *MemPipeline) rejectedText(t TweetText, err error) error {
+	atomic.AddInt64(&p.rejected, 1)
+	logText(logging.WarnLevel, "publish", t, "Text rejected", logging.Fields{"error": err})
+	return err
+}
+
+// Start is exposed by Pipeline interface. MemPipeline implements this method.
+func (p *MemPipeline) Start() {
+	// The stage-2 workers consume ValidTexts from a set of channels,
+	// process texts and publish to the next set of channels in the pipeline.
+	for _, c := range p.validTextChans {
+		p.processors.Add(1)
+		atomic.AddInt64(&p.processing, 1)
+		go func(in chan TweetText) {
+			defer p.processors.Done()
+			defer atomic.AddInt64(&p.processing, -1)
+			p.pubProcessedText(in)
+		}(c)
+	}
+	// The stage-3 workers consume ProcessedTexts from a set of channels,
+	// and perform appropriate operations (save text and update sentiment) on the datastore.
+	for _, c := range p.processedTextChans {
+		p.savers.Add(1)
+		atomic.AddInt64(&p.saving, 1)
+		go func(in chan TweetText) {
+			defer p.savers.Done()
+			defer atomic.AddInt64(&p.saving, -1)
+			for {
+				pt, ok := p.next(in)
+				if !ok {
+					return
+				}
+				start := time.Now()
+				saved := computeSentimentAndSave(pt, p.db)
+				observeStage("save", start)
+				if saved.ID != "" {
+					p.notify(saved)
+				}
+				atomic.AddInt64(&p.saved, 1)
+				atomic.AddInt64(&p.pending, -1)
+			}
+		}(c)
+	}
+}
+
+// pubProcessedText is PubProcessedText, which additionally keeps the count of the pending texts.
+func (p *MemPipeline) pubProcessedText(in chan TweetText) {
+	index := NextIndex(&p.ptRoundRobin, len(p.processedTextChans)-1)
+	for {
+		vt, ok := p.next(in)
+		if !ok {
+			return
+		}
+		start := time.Now()
+		settings := p.settings.Load().(memSettings)
+		pt := ProcessText(settings.clf, settings.weighting, vt)
+		observeStage("process", start)
+		if len(pt.Categories) == 0 {
+			atomic.AddInt64(&p.pending, -1)
+			logText(logging.DebugLevel, "process", pt, "Text discarded, it has no category", nil)
+			continue
+		}
+		logText(logging.DebugLevel, "process", pt, "Text categorized", logging.Fields{"categories": pt.Categories,
+			"lang": pt.Lang})
+		select {
+		case p.processedTextChans[index] <- pt:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// next receives the next text of a partition. It returns false once the partition is closed and drained,
+// or once the pipeline has quit, even if texts are left in the partition.
+func (p *MemPipeline) next(in chan TweetText) (TweetText, bool) {
+	select {
+	case <-p.quit:
+		return TweetText{}, false
+	default:
+	}
+	select {
+	case t, ok := <-in:
+		return t, ok
+	case <-p.quit:
+		return TweetText{}, false
+	}
+}
+
+// Observe is exposed by Observable interface. MemPipeline implements this method.
+func (p *MemPipeline) Observe(observer func(TweetText)) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.observers = append(p.observers, observer)
+}
+
+// notify calls the observers with a saved TweetText.
+func (p *MemPipeline) notify(pt TweetText) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	for _, observer := range p.observers {
+		observer(pt)
+	}
+}
+
+// observeStage records the latency of a stage that started at the supplied time.
+func observeStage(stage string, start time.Time) {
+	stageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// Reconfigure is exposed by Pipeline interface. MemPipeline implements this method.
+// The zero value of Admission indicates the Block policy, and a nil Classifier indicates the Panas classifier.
+func (p *MemPipeline) Reconfigure(adm Admission, clf classifier.Classifier, w Weighting) {
+	p.settings.Store(newMemSettings(adm, clf, w))
+}
+
+// Stop is exposed by Pipeline interface. MemPipeline implements this method.
+// Each stage is closed once the stage before it has been drained. If the context is done before
+// the pipeline is drained, the workers quit after their current text, and the texts that are still pending
+// are reported as dropped. Either way, no worker uses the datastore once Stop returns.
+func (p *MemPipeline) Stop(ctx context.Context) error {
+	p.mux.Lock()
+	if p.stopped {
+		p.mux.Unlock()
+		return nil
+	}
+	p.stopped = true
+	atomic.StoreInt64(&p.savedAtStop, atomic.LoadInt64(&p.saved))
+	p.mux.Unlock()
+	err := p.drain(ctx)
+	if err != nil {
+		close(p.quit)
+		p.processors.Wait()
+		p.savers.Wait()
+		atomic.StoreInt64(&p.dropped, atomic.LoadInt64(&p.pending))
+	}
+	return err
+}
+
+func (p *MemPipeline) drain(ctx context.Context) error {
+	// Wait for the in-flight Submit calls before closing the stage-1 channels.
+	if err := wait(ctx, &p.publishers); err != nil {
+		return err
+	}
+	for _, c := range p.validTextChans {
+		close(c)
+	}
+	if err := wait(ctx, &p.processors); err != nil {
+		return err
+	}
+	for _, c := range p.processedTextChans {
+		close(c)
+	}
+	return wait(ctx, &p.savers)
+}
+
+// Stats is exposed by Pipeline interface. MemPipeline implements this method.
+func (p *MemPipeline) Stats() Stats {
+	p.mux.RLock()
+	stopped := p.stopped
+	p.mux.RUnlock()
+	saved := atomic.LoadInt64(&p.saved)
+	var flushed int64
+	if stopped {
+		flushed = saved - atomic.LoadInt64(&p.savedAtStop)
+	}
+	return Stats{
+		Submitted: atomic.LoadInt64(&p.submitted),
+		Saved:     saved,
+		Pending:   atomic.LoadInt64(&p.pending),
+		Flushed:   flushed,
+		Dropped:   atomic.LoadInt64(&p.dropped),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+		Evicted:   atomic.LoadInt64(&p.evicted),
+		Stopped:   stopped,
+		Stages: []StageStats{
+			{Name: "validText", Partitions: partitionStats(p.validTextChans), Workers: int(atomic.LoadInt64(&p.processing))},
+			{Name: "processedText", Partitions: partitionStats(p.processedTextChans), Workers: int(atomic.LoadInt64(&p.saving))},
+		},
+	}
+}
+
+func partitionStats(chans []chan TweetText) []PartitionStats {
+	stats := []PartitionStats{}
+	for _, c := range chans {
+		stats = append(stats, PartitionStats{Len: len(c), Cap: cap(c)})
+	}
+	return stats
+}
+
+// wait waits for the WaitGroup, or for the context to be done, whichever happens first.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -5,17 +5,140 @@
 package pipeline
 
 import (
-	"github.com/coderafting/panas-go/pkg/sentiment"
+	"context"
+	"errors"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
 	"github.com/coderafting/sentiment-analysis/internal/database"
-	"log"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"strings"
 	"sync"
+	"time"
 )
 
 // TweetText represents a valid text string that can be considered for sentiment analysis,
 // based on the criteria set by the PANAS-t paper.
 type TweetText struct {
-	TextString        string
-	SentimentCategory string
+	// ID is the ID of the text in the DataStore, it is assigned at the stage-3 of the pipeline, once the text is saved.
+	ID         string
+	TextString string
+	// Categories are the sentiment categories of the text, they are detected at the stage-2 of the pipeline.
+	Categories []string
+	// Weights maps the categories to the weights of their contribution to the sentiments, as per the intensifiers
+	// of the text and the Weighting of the pipeline. A category that is missing from Weights weighs 1.
+	Weights map[string]float64
+	// Author is the author of the text, if known. Its texts can be down-weighted by the Weighting of the pipeline.
+	Author string
+	// ReceivedAt is the time at which the text was received by the service.
+	ReceivedAt time.Time
+	// RequestID is the ID of the http request that carried the text. It is logged along with the text at every stage
+	// of the pipeline, so that the log entries of a text can be correlated with each other, and with its request.
+	RequestID string
+	// Community is the community in which the text was received, its sentiments are tracked separately.
+	// An empty Community indicates the default community of the DataStore.
+	Community string
+	// Lang is the language of the text, it selects the classifier of the language at the stage-2 of the pipeline.
+	// An empty Lang indicates the default language of the DataStore.
+	Lang string
+}
+
+// ErrStopped is returned when a TweetText is submitted to a pipeline that has been stopped.
+var ErrStopped = errors.New("pipeline is stopped")
+
+// ErrSaturated is returned when a TweetText can not be admitted to a pipeline, because its partitions are full.
+var ErrSaturated = errors.New("pipeline is saturated")
+
+// AdmissionPolicy specifies the behaviour of Submit when the selected stage-1 partition is full.
+type AdmissionPolicy string
+
+const (
+	// Block waits for space in the partition, until the context of the Submit is done.
+	Block AdmissionPolicy = "block"
+	// Reject waits for space in the partition for the admission timeout, and then returns ErrSaturated.
+	Reject AdmissionPolicy = "reject"
+	// DropOldest waits for space in the partition for the admission timeout, and then evicts the oldest
+	// text of the partition to make space for the new one.
+	DropOldest AdmissionPolicy = "drop-oldest"
+)
+
+// ValidAdmissionPolicy checks if the supplied policy is one of the available admission policies.
+func ValidAdmissionPolicy(policy AdmissionPolicy) bool {
+	return policy == Block || policy == Reject || policy == DropOldest
+}
+
+// Admission specifies how a pipeline admits new texts.
+type Admission struct {
+	Policy  AdmissionPolicy
+	Timeout time.Duration
+}
+
+// Weighting specifies how the weights of the matches of a text are turned into the weights of its categories.
+// The zero value weighs every category of a text as its heaviest match.
+type Weighting struct {
+	// Split splits the weight of a text across its categories, in proportion to the weights of their matches,
+	// so that a text weighs 1 in total however many categories it has.
+	Split bool
+	// Authors maps the lower-cased authors to the factors by which the weights of their texts are multiplied,
+	// e.g. 0.1 to down-weight a prolific author, or 0 to ignore an author. The authors are matched case-insensitively,
+	// and the texts of the other authors are not modified.
+	Authors map[string]float64
+}
+
+// Pipeline is a sentiment analysis pipeline interface that can be implemented by different kinds of pipelines.
+type Pipeline interface {
+	// Submit publishes a valid TweetText to the pipeline, based on the admission policy of the pipeline.
+	Submit(ctx context.Context, t TweetText) error
+	// Start starts the workers of the pipeline stages.
+	Start()
+	// Stop stops accepting new texts, and waits for the texts in the pipeline to be saved,
+	// or for the context to be done. The pipeline no longer uses its DataStore once Stop returns.
+	Stop(ctx context.Context) error
+	// Stats returns the current state of the pipeline.
+	Stats() Stats
+	// Reconfigure replaces the admission, the classifier and the weighting of the pipeline, while its workers
+	// keep running. The texts that are already in the pipeline are not affected by the new admission.
+	Reconfigure(adm Admission, clf classifier.Classifier, w Weighting)
+}
+
+// Observable is implemented by the pipelines that report the texts saved at their stage-3.
+type Observable interface {
+	// Observe registers a function that is called with every TweetText saved by the stage-3 of the pipeline,
+	// along with its ID and categories. It is called from the stage-3 workers, so it must not block.
+	Observe(observer func(TweetText))
+}
+
+// Stats represents the state of a pipeline.
+type Stats struct {
+	// Submitted is the number of texts accepted by Submit.
+	Submitted int64
+	// Saved is the number of processed texts saved to the DataStore.
+	Saved int64
+	// Pending is the number of texts in the pipeline that have not been saved yet.
+	Pending int64
+	// Flushed is the number of processed texts saved while the pipeline was being stopped.
+	Flushed int64
+	// Dropped is the number of texts that were still pending when Stop gave up.
+	Dropped int64
+	// Rejected is the number of texts that were not admitted, because the pipeline was saturated.
+	Rejected int64
+	// Evicted is the number of texts evicted by the DropOldest admission policy.
+	Evicted int64
+	// Stopped indicates that the pipeline has been stopped, it no longer accepts texts.
+	Stopped bool
+	Stages  []StageStats
+}
+
+// StageStats represents the state of the partitions that feed a stage of the pipeline.
+type StageStats struct {
+	Name       string
+	Partitions []PartitionStats
+	// Workers is the number of running workers that consume the partitions, one per partition once started.
+	Workers int
+}
+
+// PartitionStats represents the state of a partition (channel).
+type PartitionStats struct {
+	Len int
+	Cap int
 }
 
 /*
@@ -71,14 +194,68 @@ func PubValidText(vt TweetText, chansArray []chan TweetText, indexRR *MemRR) {
 	chansArray[index] <- vt
 }
 
-// processText transforms TweetText into a collection of processed TweetText data with their Sentiment Categories.
-func processText(txt TweetText) []TweetText {
-	ctgs := sentiment.Categories(txt.TextString)
-	pts := []TweetText{}
-	for _, c := range ctgs {
-		pts = append(pts, TweetText{TextString: txt.TextString, SentimentCategory: c})
+// ProcessText detects the Sentiment Categories of a TweetText with the supplied Classifier, or with its Classifier
+// of the language of the text, and weighs them as per the supplied Weighting. A category is listed once, even if
+// the text contains more than one state of the category, and it weighs as much as its heaviest match.
+func ProcessText(clf classifier.Classifier, w Weighting, txt TweetText) TweetText {
+	ctgs := []string{}
+	weights := map[string]float64{}
+	for _, m := range classifier.ForLanguage(clf, txt.Lang).Categorize(txt.TextString) {
+		mw := m.Weight
+		if mw == 0 {
+			mw = 1
+		}
+		prev, seen := weights[m.Category]
+		if !seen {
+			ctgs = append(ctgs, m.Category)
+		}
+		if !seen || mw > prev {
+			weights[m.Category] = mw
+		}
+	}
+	txt.Categories = ctgs
+	txt.Weights = w.apply(txt.Author, weights)
+	return txt
+}
+
+// apply splits the weights of the categories of a text, and multiplies them by the factor of its author.
+func (w Weighting) apply(author string, weights map[string]float64) map[string]float64 {
+	total := 0.0
+	for _, cw := range weights {
+		total += cw
+	}
+	factor, ok := w.Authors[strings.ToLower(author)]
+	if !ok {
+		factor = 1
+	}
+	for c, cw := range weights {
+		if w.Split && total > 0 {
+			cw = cw / total
+		}
+		weights[c] = cw * factor
+	}
+	return weights
+}
+
+// logText writes a log entry about the TweetText, along with the ID of its request, its ID once it is saved,
+// and the stage of the pipeline ("publish", "process" or "save") that writes the entry.
+func logText(level logging.Level, stage string, t TweetText, msg string, fields logging.Fields) {
+	if !logging.Enabled(level) {
+		return
 	}
-	return pts
+	entry := logging.Fields{"requestID": t.RequestID, "stage": stage}
+	if t.ID != "" {
+		entry["textID"] = t.ID
+	}
+	logging.Log(level, msg, entry, fields)
+}
+
+// weight returns the weight of the contribution of a category of the TweetText.
+func (t TweetText) weight(ctg string) float64 {
+	if w, ok := t.Weights[ctg]; ok {
+		return w
+	}
+	return 1
 }
 
 /*
@@ -89,25 +266,22 @@ stages of the pipeline.
 // PubProcessedText consumes from a channel of TweetText, process the data, and publishes to
 // an appropriate channel from a collection of channels.
 // The selection of a channel happens via round-robin mechanism.
-func PubProcessedText(in chan TweetText, out []chan TweetText, indexRR *MemRR) {
+// A text without any sentiment category is not published. The categories are detected by the supplied Classifier,
+// for the language of the text.
+func PubProcessedText(clf classifier.Classifier, in chan TweetText, out []chan TweetText, indexRR *MemRR) {
 	index := NextIndex(indexRR, len(out)-1)
 	for vt := range in {
-		// Note that the following for loop is alright because
-		// the result of processText(vt) will be often a slice of 1 or 2 items.
-		// The length of the resultant slice depends upon the number of sentiment categories
-		// a text contains – this is mostly 1, and in some cases 2.
-		// It is rare that a sentence will carry more than 2 sentiment categories.
-		for _, t := range processText(vt) {
-			out[index] <- t
+		if pt := ProcessText(clf, Weighting{}, vt); len(pt.Categories) > 0 {
+			out[index] <- pt
 		}
 	}
 }
 
 // ConsumeVTPubPT triggers goroutines, each of which starts consuming a specific channel,
 // and produce the processed data to a channel from a collection of channels.
-func ConsumeVTPubPT(in []chan TweetText, out []chan TweetText, indexRR *MemRR) {
+func ConsumeVTPubPT(clf classifier.Classifier, in []chan TweetText, out []chan TweetText, indexRR *MemRR) {
 	for _, c := range in {
-		go PubProcessedText(c, out, indexRR)
+		go PubProcessedText(clf, c, out, indexRR)
 	}
 }
 
@@ -115,19 +289,41 @@ func ConsumeVTPubPT(in []chan TweetText, out []chan TweetText, indexRR *MemRR) {
 // updates the corresponding sentiments.
 func ComputeSentimentAndSave(in chan TweetText, db database.DataStore) {
 	for pt := range in {
-		txt := pt.TextString
-		ctg := pt.SentimentCategory
-		// Save text
-		_, insertErr := db.InsertText(txt)
-		if insertErr != nil {
-			log.Printf("Error inserting the text: %v", txt)
-		}
-		// Update sentiment
-		_, updateErr := db.UpdateSentiment(ctg, 1)
+		computeSentimentAndSave(pt, db)
+	}
+}
+
+// computeSentimentAndSave saves a processed TweetText to DB, and updates the sentiment of each of its categories.
+// It returns the TweetText along with its ID, which is empty if the text could not be saved.
+func computeSentimentAndSave(pt TweetText, db database.DataStore) TweetText {
+	txt := pt.TextString
+	ctgs := []database.Category{}
+	for _, ctg := range pt.Categories {
+		ctgs = append(ctgs, database.Category(ctg))
+	}
+	// Save text
+	comm := database.Community(pt.Community)
+	saved, insertErr := db.InsertText(database.Text{TextString: txt, Categories: ctgs, ReceivedAt: pt.ReceivedAt, RequestID: pt.RequestID,
+		Community: comm, Lang: pt.Lang})
+	if insertErr != nil {
+		logText(logging.ErrorLevel, "save", pt, "Error inserting the text", logging.Fields{"error": insertErr})
+	}
+	pt.ID = string(saved.ID)
+	// Update sentiment
+	for _, ctg := range pt.Categories {
+		weight := pt.weight(ctg)
+		u := database.SentimentUpdate{Community: comm, Lang: pt.Lang, Category: ctg, Count: 1, Weight: &weight,
+			At: pt.ReceivedAt, RequestID: pt.RequestID}
+		_, updateErr := db.UpdateSentiment(u)
 		if updateErr != nil {
-			log.Printf("Error updating sentiment for category: %v, with text: %v", ctg, txt)
+			logText(logging.ErrorLevel, "save", pt, "Error updating the sentiment", logging.Fields{"error": updateErr,
+				"category": ctg})
 		}
 	}
+	if insertErr == nil {
+		logText(logging.DebugLevel, "save", pt, "Text saved", logging.Fields{"categories": pt.Categories})
+	}
+	return pt
 }
 
 // ComputeAndSave triggers goroutines, each of which starts consuming a specific channel,
@@ -1,7 +1,14 @@
 package pipeline
 
 import (
+	"context"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
 	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -60,13 +67,92 @@ func TestPubValidText(t *testing.T) {
 }
 
 func TestProcessText(t *testing.T) {
-	testCase := TweetText{TextString: "I am happy and sad"}
-	out := processText(testCase)
-	if out[0].SentimentCategory != "jovility" && out[1].SentimentCategory != "sadness" {
+	testCase := TweetText{TextString: "I am happy and joyful, but sad"}
+	out := ProcessText(classifier.Panas{}, Weighting{}, testCase)
+	if len(out.Categories) != 2 || out.Categories[0] != "jovility" || out.Categories[1] != "sadness" {
 		t.Errorf("Failed: recieved %v", out)
 	}
 }
 
+func TestProcessWeightedText(t *testing.T) {
+	mods, err := classifier.NewModifiers(classifier.NoNegation, nil, map[string]float64{"very": 2}, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := ProcessText(classifier.Panas{Modifiers: mods}, Weighting{}, TweetText{TextString: "I am happy and very joyful, but sad"})
+	if out.weight("jovility") != 2 || out.weight("sadness") != 1 {
+		t.Errorf("Failed: expected the weights 2 and 1, recieved %v", out.Weights)
+	}
+	var mockDB = database.GetDatastore()
+	computeSentimentAndSave(out, mockDB)
+	sents, _ := mockDB.FetchSentiments("")
+	if sents["jovility"].TextCount != 1 || sents["jovility"].WeightedCount != 2 || sents["jovility"].Value != 2.0/3 {
+		t.Errorf("Failed: expected a TextCount of 1, a WeightedCount of 2 and a Value of 2/3, recieved %v", sents["jovility"])
+	}
+}
+
+func TestProcessTextWithWeighting(t *testing.T) {
+	mods, err := classifier.NewModifiers(classifier.NoNegation, nil, map[string]float64{"very": 3}, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clf := classifier.Panas{Modifiers: mods}
+	type testCase struct {
+		weighting Weighting
+		author    string
+		expected  map[string]float64
+	}
+	cases := []testCase{
+		testCase{weighting: Weighting{}, expected: map[string]float64{"jovility": 3, "sadness": 1}},
+		testCase{weighting: Weighting{Split: true}, expected: map[string]float64{"jovility": 0.75, "sadness": 0.25}},
+		testCase{weighting: Weighting{Authors: map[string]float64{"bot": 0.5}}, author: "bot",
+			expected: map[string]float64{"jovility": 1.5, "sadness": 0.5}},
+		testCase{weighting: Weighting{Split: true, Authors: map[string]float64{"bot": 0.5}}, author: "bot",
+			expected: map[string]float64{"jovility": 0.375, "sadness": 0.125}},
+		testCase{weighting: Weighting{Authors: map[string]float64{"bot": 0}}, author: "bot",
+			expected: map[string]float64{"jovility": 0, "sadness": 0}},
+		testCase{weighting: Weighting{Authors: map[string]float64{"bot": 0}}, author: "alice",
+			expected: map[string]float64{"jovility": 3, "sadness": 1}},
+	}
+	for _, c := range cases {
+		out := ProcessText(clf, c.weighting, TweetText{TextString: "I am very happy, but sad", Author: c.author})
+		if !reflect.DeepEqual(out.Weights, c.expected) {
+			t.Errorf("Failed for %+v: expected the weights %v, recieved %v", c.weighting, c.expected, out.Weights)
+		}
+	}
+
+	// A muted author still counts its texts, but doesn't contribute to the values.
+	var mockDB = database.GetDatastore()
+	computeSentimentAndSave(ProcessText(clf, Weighting{}, TweetText{TextString: "I am sad"}), mockDB)
+	muted := Weighting{Authors: map[string]float64{"bot": 0}}
+	computeSentimentAndSave(ProcessText(clf, muted, TweetText{TextString: "I am happy", Author: "bot"}), mockDB)
+	sents, _ := mockDB.FetchSentiments("")
+	if sents["jovility"].TextCount != 1 || sents["jovility"].Value != 0 || sents["sadness"].Value != 1 {
+		t.Errorf("Failed: expected the muted text to be counted, with no value, recieved %v", sents)
+	}
+}
+
+func TestProcessLanguageText(t *testing.T) {
+	clf := classifier.Multilingual{Default: "en", Classifiers: map[string]classifier.Classifier{
+		"en": classifier.Panas{},
+		"es": classifier.Panas{Lang: "es"},
+	}}
+	out := ProcessText(clf, Weighting{}, TweetText{TextString: "Estoy feliz y cansada", Lang: "es"})
+	if len(out.Categories) != 2 || out.Categories[0] != "jovility" || out.Categories[1] != "fatigue" {
+		t.Errorf("Failed: expected jovility and fatigue, recieved %v", out.Categories)
+	}
+	var mockDB = database.GetDatastore()
+	computeSentimentAndSave(out, mockDB)
+	sents, _ := mockDB.FetchLanguageSentiments("")
+	if len(sents) != 1 || sents["es"]["fatigue"].TextCount != 1 {
+		t.Errorf("Failed: expected the sentiments of es only, recieved %v", sents)
+	}
+	page, _ := mockDB.FetchTexts(database.TextQuery{Lang: "es"})
+	if len(page.Texts) != 1 {
+		t.Errorf("Failed: expected a text in es, recieved %v", page.Texts)
+	}
+}
+
 func TestConsumeVTPubPT(t *testing.T) {
 	validText := TweetText{TextString: "I am happy"}
 	vtch := make(chan TweetText, 1)
@@ -79,7 +165,7 @@ func TestConsumeVTPubPT(t *testing.T) {
 	rr := MemRR{Index: 0}
 
 	PubValidText(validText, vtChans, &vtrr)
-	ConsumeVTPubPT(vtChans, outchans, &rr)
+	ConsumeVTPubPT(classifier.Panas{}, vtChans, outchans, &rr)
 	out := <-outchans[rr.Index]
 	if out.TextString != validText.TextString {
 		t.Errorf("Failed: expected: %v, recieved %v", validText.TextString, out.TextString)
@@ -98,11 +184,238 @@ func TestComputeAndSave(t *testing.T) {
 	rr := MemRR{Index: 0}
 
 	PubValidText(validText, vtChans, &vtrr)
-	ConsumeVTPubPT(vtChans, outchans, &rr)
+	ConsumeVTPubPT(classifier.Panas{}, vtChans, outchans, &rr)
 	ComputeAndSave(outchans, mockDB)
 	time.Sleep(2 * time.Second) // just for a simplified testing
-	out, _ := mockDB.FetchCategorySentiments("jovility")
+	out, _ := mockDB.FetchCategorySentiments("", "jovility")
 	if out["jovility"].TextCount != 1 {
 		t.Errorf("Failed: expected: %v, recieved %v", 1, out["jovility"].TextCount)
 	}
 }
+
+// stageObservations returns the number of the latencies observed for a stage of the pipeline.
+func stageObservations(stage string) uint64 {
+	var m dto.Metric
+	stageDuration.WithLabelValues(stage).(prometheus.Metric).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMemPipeline(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	p := GetMemPipeline(2, 1, Admission{}, classifier.Panas{}, Weighting{}, mockDB)
+	published, processed, saved := stageObservations("publish"), stageObservations("process"), stageObservations("save")
+	p.Start()
+	if stats := p.Stats(); stats.Stopped || stats.Stages[0].Workers != 2 || stats.Stages[1].Workers != 2 {
+		t.Errorf("Failed: expected 2 running workers per stage, recieved %v", stats)
+	}
+	texts := []string{"I am happy", "I am sad", "I feel happy"}
+	for _, txt := range texts {
+		if err := p.Submit(context.Background(), TweetText{TextString: txt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(context.Background(), TweetText{TextString: "I am happy"}); err != ErrStopped {
+		t.Errorf("Failed: expected: %v, recieved %v", ErrStopped, err)
+	}
+	stats := p.Stats()
+	if !stats.Stopped || stats.Stages[0].Workers != 0 || stats.Stages[1].Workers != 0 {
+		t.Errorf("Failed: expected a stopped pipeline without workers, recieved %v", stats)
+	}
+	if stats.Submitted != 3 || stats.Saved != 3 {
+		t.Errorf("Failed: expected Submitted and Saved: %v, recieved %v and %v", 3, stats.Submitted, stats.Saved)
+	}
+	if len(stats.Stages) != 2 || len(stats.Stages[0].Partitions) != 2 || stats.Stages[0].Partitions[0].Cap != 1 {
+		t.Errorf("Failed: unexpected stages: %v", stats.Stages)
+	}
+	out, _ := mockDB.FetchCategorySentiments("", "jovility")
+	if out["jovility"].TextCount != 2 {
+		t.Errorf("Failed: expected: %v, recieved %v", 2, out["jovility"].TextCount)
+	}
+	for stage, before := range map[string]uint64{"publish": published, "process": processed, "save": saved} {
+		if observed := stageObservations(stage) - before; observed != 3 {
+			t.Errorf("Failed: expected %v latencies of the %v stage, recieved %v", 3, stage, observed)
+		}
+	}
+}
+
+func TestMemPipelineStopReportsDropped(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	// The pipeline is not started, the texts can not leave the stage-1 partition.
+	p := GetMemPipeline(1, 1, Admission{}, classifier.Panas{}, Weighting{}, mockDB)
+	p.Submit(context.Background(), TweetText{TextString: "I am happy"})
+	go p.Submit(context.Background(), TweetText{TextString: "I am sad"})
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Failed: expected: %v, recieved %v", context.DeadlineExceeded, err)
+	}
+	// The second text is still waiting to be admitted, only the admitted text is dropped.
+	if stats := p.Stats(); stats.Dropped != 1 || stats.Flushed != 0 {
+		t.Errorf("Failed: expected Dropped: %v and Flushed: %v, recieved %v and %v", 1, 0, stats.Dropped, stats.Flushed)
+	}
+}
+
+// slowDB is a DataStore whose inserts take a while, it counts the inserts made after it has been closed.
+type slowDB struct {
+	database.DataStore
+	closed      int32
+	afterClosed int32
+}
+
+func (db *slowDB) InsertText(t database.Text) (database.Text, error) {
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&db.closed) == 1 {
+		atomic.AddInt32(&db.afterClosed, 1)
+	}
+	return db.DataStore.InsertText(t)
+}
+
+func TestMemPipelineStopWaitsForTheWorkers(t *testing.T) {
+	db := &slowDB{DataStore: database.GetDatastore()}
+	p := GetMemPipeline(1, 10, Admission{}, classifier.Panas{}, Weighting{}, db)
+	p.Start()
+	for i := 0; i < 10; i++ {
+		if err := p.Submit(context.Background(), TweetText{TextString: "I am happy"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Failed: expected: %v, recieved %v", context.DeadlineExceeded, err)
+	}
+	atomic.StoreInt32(&db.closed, 1)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&db.afterClosed); n != 0 {
+		t.Errorf("Failed: expected no insert once Stop returned, recieved %v", n)
+	}
+	stats := p.Stats()
+	if stats.Stages[0].Workers != 0 || stats.Stages[1].Workers != 0 {
+		t.Errorf("Failed: expected no running worker, recieved %v", stats.Stages)
+	}
+	if stats.Saved+stats.Dropped != 10 {
+		t.Errorf("Failed: expected %v saved or dropped texts, recieved %v and %v", 10, stats.Saved, stats.Dropped)
+	}
+}
+
+func TestMemPipelineAdmission(t *testing.T) {
+	type testCase struct {
+		policy   AdmissionPolicy
+		err      error
+		rejected int64
+		evicted  int64
+		head     string
+	}
+	cases := []testCase{
+		{policy: Reject, err: ErrSaturated, rejected: 1, evicted: 0, head: "I am happy"},
+		{policy: DropOldest, err: nil, rejected: 0, evicted: 1, head: "I am sad"},
+	}
+	for _, c := range cases {
+		// The pipeline is not started, the texts can not leave the stage-1 partition.
+		p := GetMemPipeline(1, 1, Admission{Policy: c.policy, Timeout: 10 * time.Millisecond}, classifier.Panas{}, Weighting{}, database.GetDatastore())
+		p.Submit(context.Background(), TweetText{TextString: "I am happy"})
+		err := p.Submit(context.Background(), TweetText{TextString: "I am sad"})
+		if err != c.err {
+			t.Errorf("Failed: %v: expected: %v, recieved %v", c.policy, c.err, err)
+		}
+		stats := p.Stats()
+		if stats.Rejected != c.rejected || stats.Evicted != c.evicted || stats.Pending != 1 {
+			t.Errorf("Failed: %v: expected Rejected: %v, Evicted: %v, Pending: 1, recieved %v, %v, %v", c.policy, c.rejected, c.evicted, stats.Rejected, stats.Evicted, stats.Pending)
+		}
+		if head := <-p.validTextChans[0]; head.TextString != c.head {
+			t.Errorf("Failed: %v: expected: %v, recieved %v", c.policy, c.head, head.TextString)
+		}
+	}
+}
+
+func TestMemPipelineStoresTextOnce(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	p := GetMemPipeline(2, 1, Admission{}, classifier.Panas{}, Weighting{}, mockDB)
+	p.Start()
+	receivedAt := time.Now().UTC()
+	p.Submit(context.Background(), TweetText{TextString: "I am happy and sad", ReceivedAt: receivedAt, RequestID: "req-1"})
+	p.Stop(context.Background())
+	page, _ := mockDB.FetchTexts(database.TextQuery{})
+	if len(page.Texts) != 1 {
+		t.Fatalf("Failed: expected %v text, recieved %v", 1, page.Texts)
+	}
+	txt := page.Texts[0]
+	if len(txt.Categories) != 2 || !txt.HasCategory("jovility") || !txt.HasCategory("sadness") {
+		t.Errorf("Failed: expected categories jovility and sadness, recieved %v", txt.Categories)
+	}
+	if txt.RequestID != "req-1" || !txt.ReceivedAt.Equal(receivedAt) {
+		t.Errorf("Failed: expected RequestID %v and ReceivedAt %v, recieved %v and %v", "req-1", receivedAt, txt.RequestID, txt.ReceivedAt)
+	}
+	sents, _ := mockDB.FetchSentiments("")
+	if sents["jovility"].TextCount != 1 || sents["sadness"].TextCount != 1 {
+		t.Errorf("Failed: expected a TextCount of 1 for both the categories, recieved %v", sents)
+	}
+}
+
+// fearful is a Classifier that categorizes every text as fear.
+type fearful struct{}
+
+func (fearful) Validate(txt string) bool {
+	return true
+}
+
+func (fearful) Categorize(txt string) []classifier.Match {
+	return []classifier.Match{classifier.Match{Category: "fear", Weight: 1}}
+}
+
+func (fearful) Categories() []string {
+	return []string{"fear"}
+}
+
+func TestMemPipelineReconfigure(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	p := GetMemPipeline(2, 1, Admission{}, classifier.Panas{}, Weighting{}, mockDB)
+	p.Start()
+	p.Submit(context.Background(), TweetText{TextString: "I am happy"})
+	// Wait for the text to be saved, so that it is categorized before the classifier is replaced.
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Saved < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	p.Reconfigure(Admission{Policy: Reject, Timeout: time.Millisecond}, fearful{}, Weighting{})
+	p.Submit(context.Background(), TweetText{TextString: "I am happy"})
+	p.Stop(context.Background())
+	sents, _ := mockDB.FetchSentiments("")
+	if sents["jovility"].TextCount != 1 || sents["fear"].TextCount != 1 {
+		t.Errorf("Failed: expected a TextCount of 1 for jovility and fear, recieved %v", sents)
+	}
+	if adm := p.settings.Load().(memSettings).admission; adm.Policy != Reject {
+		t.Errorf("Failed: expected the %v admission policy, recieved %v", Reject, adm.Policy)
+	}
+}
+
+func TestMemPipelineObserve(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	p := GetMemPipeline(2, 1, Admission{}, classifier.Panas{}, Weighting{}, mockDB)
+	var mux sync.Mutex
+	observed := map[string]TweetText{}
+	p.Observe(func(pt TweetText) {
+		mux.Lock()
+		defer mux.Unlock()
+		observed[pt.TextString] = pt
+	})
+	p.Start()
+	for _, txt := range []string{"I am happy", "I am at work", "I am sad"} {
+		p.Submit(context.Background(), TweetText{TextString: txt, Community: "#friday"})
+	}
+	p.Stop(context.Background())
+	if len(observed) != 2 {
+		t.Fatalf("Failed: expected %v observed texts, recieved %v", 2, observed)
+	}
+	pt := observed["I am sad"]
+	if saved, err := mockDB.FetchText(database.ID(pt.ID)); err != nil || saved.TextString != "I am sad" {
+		t.Errorf("Failed: expected the ID of the saved text, recieved %v", pt.ID)
+	}
+	if len(pt.Categories) != 1 || pt.Categories[0] != "sadness" || pt.Community != "#friday" {
+		t.Errorf("Failed: unexpected observed text: %v", pt)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"net/http"
+)
+
+// AnalyzeResp is used for creating a response object for Analyze handler.
+// Valid tells whether the text would be published by SaveText, and Reasons explain why it would not, or why it would
+// be assigned no category. Categories and Weights are the categories that the stage-2 of the pipeline would assign
+// to the text, they are computed even if the text is not valid.
+type AnalyzeResp struct {
+	Valid      bool
+	Lang       string
+	Tokens     []string
+	SelfRefs   []string
+	States     []classifier.StateMatch
+	Categories []string
+	Weights    map[string]float64
+	Reasons    []string
+}
+
+// Analyze is an http handler that validates and categorizes the incoming text, exactly like SaveText and the pipeline
+// do, without publishing it to the pipeline. It responds with the explanation of the outcome.
+func (h *Handler) Analyze(w http.ResponseWriter, r *http.Request) {
+	var tx SaveTextReq
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	rt := h.settings()
+	if reason := invalidTextReason(rt.det, tx); reason != "" {
+		utils.JSONErrorResponse(w, reason)
+		return
+	}
+	lang := textLang(rt.det, tx)
+	exp := classifier.Explain(classifier.ForLanguage(rt.clf, lang), tx.TextString)
+	pt := pipeline.ProcessText(rt.clf, rt.weighting, pipeline.TweetText{TextString: tx.TextString, Lang: lang,
+		Author: tx.Author})
+	data := AnalyzeResp{
+		Valid:      exp.Valid,
+		Lang:       lang,
+		Tokens:     exp.Tokens,
+		SelfRefs:   exp.SelfRefs,
+		States:     exp.States,
+		Categories: pt.Categories,
+		Weights:    pt.Weights,
+		Reasons:    exp.Reasons,
+	}
+	utils.JSONSuccessResponse(w, data)
+}
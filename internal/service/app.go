@@ -6,48 +6,198 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"github.com/coderafting/sentiment-analysis/config"
 	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
 	"github.com/coderafting/sentiment-analysis/internal/pipeline"
 	"github.com/go-chi/chi"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // App contains the server configuration and http routes.
 type App struct {
-	Cf config.Config
-	r  *chi.Mux
+	Cf  config.Config
+	r   *chi.Mux
+	db  database.DataStore
+	pl  pipeline.Pipeline
+	h   *Handler
+	srv *http.Server
+	// stop is closed on shutdown, it stops the background tasks of the App, which are waited for before the
+	// datastore is closed.
+	stop  chan struct{}
+	tasks sync.WaitGroup
 }
 
-// There are two partition-sets (two sets of collection of channels) at the two stages of the pipeline,
-// therefore, two round-robin states will have to be maintained.
-var memVTPIndex = pipeline.MemRR{Index: 0}
-var memPTPIndex = pipeline.MemRR{Index: 0}
-
 // Initialization setup for an App instance.
 func (a *App) init() {
-	db := database.GetDatastore()
-	validTextParts := pipeline.MemPartitions(a.Cf.Partitions, a.Cf.PartitionBuffer)
-	processedTextParts := pipeline.MemPartitions(a.Cf.Partitions, a.Cf.PartitionBuffer)
-	h := GetHandler(db, config.GetConfig(), validTextParts, processedTextParts, &memVTPIndex, &memPTPIndex)
-	a.r = Routes(h)
-	// initialize consumers and publishers for the 2nd and 3rd stage of the pipeline:
-	// consumeVTPubPT fires goroutines that consume ValidTexts from a set of channels,
-	// processe texts and publish to the next set of channels in the pipeline.
-	go pipeline.ConsumeVTPubPT(h.validTextChans, h.processedTextChans, h.ptRoundRobin)
-	// computeAndSave fires goroutines that consume ProcessedTexts from a set of channels,
-	// and performs appropriate operations (save text and update sentiment) on the datastore.
-	go pipeline.ComputeAndSave(h.processedTextChans, db)
+	level, err := getLogLevel(a.Cf)
+	if err != nil {
+		logging.Fatal("Invalid log level", logging.Fields{"error": err})
+	}
+	logging.SetLevel(level)
+	a.db = database.Instrument(getDatastore(a.Cf))
+	a.stop = make(chan struct{})
+	a.tasks.Add(1)
+	go func() {
+		defer a.tasks.Done()
+		freezeConfiguredBaseline(a.db, a.Cf.Baseline, a.stop)
+	}()
+	clf, err := getClassifier(a.Cf)
+	if err != nil {
+		logging.Fatal("Invalid classifier configuration", logging.Fields{"error": err})
+	}
+	adm, err := getAdmission(a.Cf)
+	if err != nil {
+		logging.Fatal("Invalid admission configuration", logging.Fields{"error": err})
+	}
+	weighting, err := getWeighting(a.Cf)
+	if err != nil {
+		logging.Fatal("Invalid weighting configuration", logging.Fields{"error": err})
+	}
+	a.pl = pipeline.GetMemPipeline(a.Cf.Partitions, a.Cf.PartitionBuffer, adm, clf, weighting, a.db)
+	a.h = GetHandler(a.db, a.Cf, a.pl, clf)
+	a.r = Routes(a.h)
+	a.srv = &http.Server{Addr: a.Cf.Port, Handler: a.r}
+	// The streams are long-lived requests, they are closed as soon as the shutdown starts.
+	a.srv.RegisterOnShutdown(a.h.broker.Close)
+	a.srv.RegisterOnShutdown(a.h.feed.Close)
+	// initialize consumers and publishers for the 2nd and 3rd stage of the pipeline.
+	a.pl.Start()
+}
+
+// getDatastore instantiates the DataStore implementation selected in the configuration.
+func getDatastore(cf config.Config) database.DataStore {
+	switch cf.Datastore {
+	case "file":
+		db, err := database.GetFileDatastore(cf.DataDir, cf.CompactionInterval)
+		if err != nil {
+			logging.Fatal("Error while opening the datastore", logging.Fields{"error": err, "dir": cf.DataDir})
+		}
+		return db
+	case "memory", "":
+		return database.GetDatastore()
+	default:
+		logging.Fatal("Unknown datastore", logging.Fields{"datastore": cf.Datastore})
+		return nil
+	}
+}
+
+// baselineRetry is the interval at which the freeze of a configured firstDays baseline is retried,
+// while the history is empty, i.e. while the window has not started.
+const baselineRetry = time.Minute
+
+// freezeConfiguredBaseline freezes the baseline window of the configuration, if one is configured, once the window
+// is over. A baseline that is already stored, e.g. frozen before a restart, is kept. It returns once the baseline is
+// frozen, the freeze fails, or stop is closed.
+func freezeConfiguredBaseline(db database.DataStore, bc config.BaselineConfig, stop <-chan struct{}) {
+	if bc == (config.BaselineConfig{}) {
+		return
+	}
+	w := database.BaselineWindow{FirstDays: bc.FirstDays, From: bc.From, To: bc.To, Closed: true}
+	for {
+		if b, err := db.FetchBaseline(""); err == nil {
+			logging.Info("A baseline is already stored, the configured baseline is not frozen",
+				logging.Fields{"from": b.From, "to": b.To})
+			return
+		}
+		b, err := db.FreezeBaseline(w)
+		var wait time.Duration
+		switch {
+		case err == nil:
+			logging.Info("Baseline frozen", logging.Fields{"from": b.From, "to": b.To, "totalTexts": b.TotalTexts})
+			return
+		case errors.Is(err, database.ErrOpenWindow):
+			wait = time.Until(b.To)
+			logging.Info("The configured baseline is frozen once its window is over", logging.Fields{"to": b.To})
+		case errors.Is(err, database.ErrInvalidWindow) && w.FirstDays > 0:
+			// The history is empty, the window starts with the first text.
+			wait = baselineRetry
+		default:
+			logging.Error("Error while freezing the configured baseline", logging.Fields{"error": err})
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
 }
 
 // GetApp instantiates an app with its configuration, handlers, and routes.
+// The reloadable settings are reloaded whenever the config file changes.
 func GetApp() *App {
 	a := App{Cf: config.GetConfig()}
 	a.init()
+	err := config.WatchConfig(func() {
+		resp, err := a.h.reloadConfigFile()
+		if err != nil {
+			logging.Error("Error while reloading the changed configuration, the current settings are kept",
+				logging.Fields{"error": err})
+			return
+		}
+		logging.Info("Configuration reloaded", logging.Fields{"reloaded": resp.Reloaded, "restartRequired": resp.RestartRequired})
+	})
+	if err != nil {
+		logging.Warn("Error while watching the config file, it is reloaded by POST /admin/reload only",
+			logging.Fields{"error": err})
+	}
 	return &a
 }
 
 // StartServer starts the http server for the supplied App instance.
-func (a *App) StartServer() {
-	http.ListenAndServe(a.Cf.Port, a.r)
+// It blocks until the server fails to start, or until a SIGINT or SIGTERM is received, in which case
+// the App is shut down gracefully.
+func (a *App) StartServer() error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- a.srv.ListenAndServe()
+	}()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-sigs:
+		logging.Info("Shutting down", logging.Fields{"signal": sig.String()})
+	}
+	return a.Shutdown()
+}
+
+// Shutdown stops accepting http requests, drains both the stages of the pipeline, and closes the datastore.
+// The draining is bounded by the ShutdownTimeout, the texts that could not be saved in time are reported as dropped.
+func (a *App) Shutdown() error {
+	ctx := context.Background()
+	if a.Cf.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Cf.ShutdownTimeout)
+		defer cancel()
+	}
+	close(a.stop)
+	// No new texts can be submitted once the http server is shut down.
+	if err := a.srv.Shutdown(ctx); err != nil {
+		logging.Error("Error while shutting down the http server", logging.Fields{"error": err})
+	}
+	stopErr := a.pl.Stop(ctx)
+	stats := a.pl.Stats()
+	logging.Info("Pipeline stopped", logging.Fields{"flushed": stats.Flushed, "dropped": stats.Dropped})
+	a.tasks.Wait()
+	// Even when the draining timed out, the workers have exited, the datastore can be closed.
+	if c, ok := a.db.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logging.Error("Error while closing the datastore", logging.Fields{"error": err})
+		}
+	}
+	return stopErr
 }
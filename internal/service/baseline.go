@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"net/http"
+	"time"
+)
+
+// SentimentResp represents the sentiment details of a category in the http responses.
+// TextCount is the raw count of the texts of the category, and WeightedCount is the sum of their weights, Value is
+// computed from the WeightedCount. Baseline and Relative are present only when a baseline has been frozen, and
+// the baseline value of the category is not 0. Relative is the relative change of Value against Baseline.
+// Languages holds the sentiment of the category within every language, it is present only when the breakdown
+// by language is requested.
+type SentimentResp struct {
+	Value         float64
+	TextCount     int
+	WeightedCount float64
+	Baseline      *float64                 `json:",omitempty"`
+	Relative      *float64                 `json:",omitempty"`
+	Languages     map[string]SentimentResp `json:",omitempty"`
+}
+
+// SeriesBucketResp represents a bucket of a sentiment time-series in the http responses.
+type SeriesBucketResp struct {
+	Start      time.Time
+	Sentiments map[database.Category]SentimentResp
+	TotalTexts int
+}
+
+// baseline returns the frozen baseline of the community, or nil if there is none.
+// An empty community selects the baseline of all the communities.
+func (h *Handler) baseline(comm database.Community) *database.Baseline {
+	b, err := h.db.FetchBaseline(comm)
+	if err != nil {
+		return nil
+	}
+	return &b
+}
+
+// withBaseline adds the baseline details to the sentiments of the categories.
+func withBaseline(sents map[database.Category]database.Sentiment, b *database.Baseline) map[database.Category]SentimentResp {
+	resp := map[database.Category]SentimentResp{}
+	for c, s := range sents {
+		sr := SentimentResp{Value: s.Value, TextCount: s.TextCount, WeightedCount: s.WeightedCount}
+		if b != nil {
+			if rel, ok := b.Relative(c, s.Value); ok {
+				base := b.Values[c]
+				sr.Baseline, sr.Relative = &base, &rel
+			}
+		}
+		resp[c] = sr
+	}
+	return resp
+}
+
+// seriesWithBaseline adds the baseline details to the sentiments of every bucket of a time-series.
+func seriesWithBaseline(series []database.SeriesBucket, b *database.Baseline) []SeriesBucketResp {
+	resp := []SeriesBucketResp{}
+	for _, sb := range series {
+		resp = append(resp, SeriesBucketResp{Start: sb.Start, Sentiments: withBaseline(sb.Sentiments, b), TotalTexts: sb.TotalTexts})
+	}
+	return resp
+}
+
+// FreezeBaseline is an http handler that computes the baseline from the sentiment history within the window
+// supplied in the request body, either {"FirstDays": n} or {"From": <RFC3339>, "To": <RFC3339>}, and stores it.
+// The optional "Community" of the body selects the history, and the baseline, of a single community.
+// The sentiments are reported as a relative change against this baseline, from then on.
+func (h *Handler) FreezeBaseline(w http.ResponseWriter, r *http.Request) {
+	var bw database.BaselineWindow
+	if err := json.NewDecoder(r.Body).Decode(&bw); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	data, err := h.db.FreezeBaseline(bw)
+	if errors.Is(err, database.ErrUnknownCommunity) {
+		utils.JSONNotFoundResponse(w, err.Error())
+		return
+	}
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	utils.JSONSuccessResponse(w, data)
+}
+
+// GetBaseline is an http handler that returns the baseline of the community query param, or of all the communities
+// if it is not supplied. It responds with 404 if the community is unknown, or if the baseline has not been frozen yet.
+func (h *Handler) GetBaseline(w http.ResponseWriter, r *http.Request) {
+	data, err := h.db.FetchBaseline(database.Community(r.URL.Query().Get("community")))
+	if errors.Is(err, database.ErrNoBaseline) || errors.Is(err, database.ErrUnknownCommunity) {
+		utils.JSONNotFoundResponse(w, err.Error())
+		return
+	}
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	utils.JSONSuccessResponse(w, data)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"io"
+	"net/http"
+)
+
+// Statuses of the items of a batch.
+const (
+	batchAccepted = "accepted"
+	batchInvalid  = "invalid"
+	batchRejected = "rejected"
+)
+
+// maxBatchLineSize is the maximum size of a line of an NDJSON batch.
+const maxBatchLineSize = 1 << 20
+
+var errBatchTooLarge = errors.New("batch is too large")
+
+// BatchItemResult represents the outcome of an item of a batch, identified by its position in the batch.
+type BatchItemResult struct {
+	Index  int
+	Status string
+	Reason string `json:",omitempty"`
+}
+
+// SaveTextsResp is used for creating a response object for SaveTexts handler.
+type SaveTextsResp struct {
+	Accepted int
+	Invalid  int
+	Rejected int
+	Results  []BatchItemResult
+}
+
+// batchItem is an item of a batch, along with the error encountered while decoding it.
+type batchItem struct {
+	req SaveTextReq
+	err error
+}
+
+// readBatch decodes a batch of SaveTextReq, which can either be a JSON array, or a newline-delimited JSON stream.
+// An item that is not a SaveTextReq object is reported with the item, a malformed batch is reported as an error.
+func readBatch(body io.Reader, maxItems int) ([]batchItem, error) {
+	br := bufio.NewReader(body)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return []batchItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := []batchItem{}
+	add := func(raw []byte) error {
+		if maxItems > 0 && len(items) == maxItems {
+			return errBatchTooLarge
+		}
+		var req SaveTextReq
+		err := json.Unmarshal(raw, &req)
+		items = append(items, batchItem{req: req, err: err})
+		return nil
+	}
+	if first == '[' {
+		dec := json.NewDecoder(br)
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			if err := add(raw); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := add(line); err != nil {
+			return nil, err
+		}
+	}
+	return items, scanner.Err()
+}
+
+// peekNonSpace returns the first non-whitespace byte of the reader, without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// SaveTexts is an http handler that accepts a batch of texts, either as a JSON array or as a newline-delimited
+// JSON stream of SaveTextReq objects. The valid texts are published to the pipeline, exactly like SaveText does.
+// It returns the outcome of every item of the batch, along with the aggregate counts.
+func (h *Handler) SaveTexts(w http.ResponseWriter, r *http.Request) {
+	rt := h.settings()
+	items, err := readBatch(r.Body, rt.cf.BatchMaxItems)
+	if err == errBatchTooLarge {
+		utils.JSONTooLargeResponse(w, fmt.Sprintf("A batch can contain at most %v items", rt.cf.BatchMaxItems))
+		return
+	}
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	resp := SaveTextsResp{Results: []BatchItemResult{}}
+	// Once the pipeline refuses a text, e.g. because it is saturated, the rest of the batch is rejected
+	// without waiting for the admission again.
+	var submitErr error
+	for i, item := range items {
+		res := BatchItemResult{Index: i, Status: batchAccepted}
+		lang := textLang(rt.det, item.req)
+		reason := invalidTextReason(rt.det, item.req)
+		switch {
+		case item.err != nil:
+			res.Status, res.Reason = batchInvalid, item.err.Error()
+		case reason != "":
+			res.Status, res.Reason = batchInvalid, reason
+		case !classifier.ForLanguage(rt.clf, lang).Validate(item.req.TextString):
+			res.Status, res.Reason = batchInvalid, "Text is not valid as per the classifier"
+		case submitErr != nil:
+			res.Status, res.Reason = batchRejected, submitErr.Error()
+		default:
+			if err := h.pl.Submit(r.Context(), newTweetText(r, item.req, lang)); err != nil {
+				res.Status, res.Reason = batchRejected, err.Error()
+				submitErr = err
+			}
+		}
+		textsReceived.Inc()
+		switch res.Status {
+		case batchAccepted:
+			textsValid.Inc()
+			resp.Accepted++
+		case batchInvalid:
+			textsInvalid.Inc()
+			resp.Invalid++
+		case batchRejected:
+			// The rejected texts are valid, as they are in POST /text.
+			textsValid.Inc()
+			resp.Rejected++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	if submitErr == pipeline.ErrSaturated {
+		h.setRetryAfter(w)
+	}
+	utils.JSONSuccessResponse(w, resp)
+}
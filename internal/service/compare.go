@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/stats"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfidence is the confidence level of the comparisons, when a request doesn't specify one.
+const defaultConfidence = 0.95
+
+// CompareGroup represents one of the two groups of texts of a comparison: the texts of a community,
+// optionally restricted to a time window. An empty Community indicates all the communities.
+type CompareGroup struct {
+	Community  database.Community `json:",omitempty"`
+	From       *time.Time         `json:",omitempty"`
+	To         *time.Time         `json:",omitempty"`
+	TotalTexts int
+}
+
+// CategoryComparison represents the comparison of the share of a category in the two groups.
+// Difference is ShareA - ShareB, Lower and Upper are the bounds of its confidence interval,
+// and Z and PValue are the outcome of the two-proportion z-test.
+type CategoryComparison struct {
+	ShareA      float64
+	ShareB      float64
+	Difference  float64
+	Lower       float64
+	Upper       float64
+	Z           float64
+	PValue      float64
+	Significant bool
+}
+
+// CompareResp is used for creating a response object for CompareSentiments handler.
+type CompareResp struct {
+	A          CompareGroup
+	B          CompareGroup
+	Confidence float64
+	Categories map[database.Category]CategoryComparison
+}
+
+// parseGroup reads a CompareGroup from the query params, the community from the lowercase name param,
+// and the time window from the from<name> and to<name> params. Both bounds of a window must be supplied.
+func parseGroup(r *http.Request, name string) (CompareGroup, error) {
+	params := r.URL.Query()
+	g := CompareGroup{Community: database.Community(params.Get(strings.ToLower(name)))}
+	from, to := params.Get("from"+name), params.Get("to"+name)
+	if from == "" && to == "" {
+		return g, nil
+	}
+	if from == "" || to == "" {
+		return g, fmt.Errorf("both from%v and to%v must be supplied", name, name)
+	}
+	f, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return g, fmt.Errorf("from%v must be an RFC3339 time: %v", name, err)
+	}
+	t, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return g, fmt.Errorf("to%v must be an RFC3339 time: %v", name, err)
+	}
+	if !f.Before(t) {
+		return g, fmt.Errorf("from%v must be before to%v", name, name)
+	}
+	g.From, g.To = &f, &t
+	return g, nil
+}
+
+// groupCounts returns the text counts of the categories within the group, and sets the TotalTexts of the group.
+// The raw text counts are compared, rather than the weighted ones, as the z-test is defined over counts of texts.
+func (h *Handler) groupCounts(g *CompareGroup) (map[database.Category]int, error) {
+	counts := map[database.Category]int{}
+	if g.From == nil {
+		sents, err := h.db.FetchSentiments(g.Community)
+		if err != nil {
+			return counts, err
+		}
+		for c, s := range sents {
+			counts[c] = s.TextCount
+			g.TotalTexts += s.TextCount
+		}
+		return counts, nil
+	}
+	series, err := h.db.FetchTimeSeries(database.SeriesQuery{From: *g.From, To: *g.To, Bucket: database.Minute, Community: g.Community})
+	if err != nil {
+		return counts, err
+	}
+	for _, sb := range series {
+		for c, s := range sb.Sentiments {
+			counts[c] += s.TextCount
+		}
+		g.TotalTexts += sb.TotalTexts
+	}
+	return counts, nil
+}
+
+// CompareSentiments is an http handler that compares the share of every sentiment category in two groups of texts.
+// The groups are selected by the a and b query params (communities, all the communities by default),
+// and optionally by the fromA, toA, fromB and toB query params (RFC3339 time windows).
+// The confidence query param sets the confidence level of the intervals and of the significance, it defaults to 0.95.
+func (h *Handler) CompareSentiments(w http.ResponseWriter, r *http.Request) {
+	resp := CompareResp{Confidence: defaultConfidence, Categories: map[database.Category]CategoryComparison{}}
+	if c := r.URL.Query().Get("confidence"); c != "" {
+		conf, err := strconv.ParseFloat(c, 64)
+		if err != nil || conf <= 0 || conf >= 1 {
+			utils.JSONErrorResponse(w, "confidence must be a number between 0 and 1")
+			return
+		}
+		resp.Confidence = conf
+	}
+	var err error
+	if resp.A, err = parseGroup(r, "A"); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	if resp.B, err = parseGroup(r, "B"); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	countsA, err := h.groupCounts(&resp.A)
+	if err != nil {
+		fetchErrorResponse(w, err)
+		return
+	}
+	countsB, err := h.groupCounts(&resp.B)
+	if err != nil {
+		fetchErrorResponse(w, err)
+		return
+	}
+	if resp.A.TotalTexts == 0 || resp.B.TotalTexts == 0 {
+		utils.JSONErrorResponse(w, "Both groups must hold some texts")
+		return
+	}
+	catgs := map[database.Category]bool{}
+	for c := range countsA {
+		catgs[c] = true
+	}
+	for c := range countsB {
+		catgs[c] = true
+	}
+	for c := range catgs {
+		a := stats.Proportion{X: countsA[c], N: resp.A.TotalTexts}
+		b := stats.Proportion{X: countsB[c], N: resp.B.TotalTexts}
+		cmp, err := stats.CompareProportions(a, b, resp.Confidence)
+		if err != nil {
+			utils.JSONErrorResponse(w, err.Error())
+			return
+		}
+		resp.Categories[c] = CategoryComparison{
+			ShareA:      a.Share(),
+			ShareB:      b.Share(),
+			Difference:  cmp.Difference,
+			Lower:       cmp.Lower,
+			Upper:       cmp.Upper,
+			Z:           cmp.Z,
+			PValue:      cmp.PValue,
+			Significant: cmp.Significant(resp.Confidence),
+		}
+	}
+	utils.JSONSuccessResponse(w, resp)
+}
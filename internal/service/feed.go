@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/stream"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// feedSubscribeTimeout is the time a client of the texts feed has to send its subscription.
+	feedSubscribeTimeout = 10 * time.Second
+	// feedWriteTimeout is the time a client of the texts feed has to receive a text, before it is disconnected.
+	feedWriteTimeout = 10 * time.Second
+)
+
+// errFeedOrigin is returned by the handshake of the texts feed when the Origin of the request is not allowed.
+var errFeedOrigin = errors.New("origin not allowed")
+
+// FeedSubscribeReq is the first message of a client of the texts feed, it selects the texts of the feed.
+// A text is sent if it has at least one of the Categories, and if it belongs to one of the Communities.
+// An empty list selects all the texts.
+type FeedSubscribeReq struct {
+	Categories  []string
+	Communities []string
+}
+
+// FeedTextResp is a message of the texts feed.
+type FeedTextResp struct {
+	stream.Text
+	// Dropped is the number of texts that were dropped before this one, because the client didn't keep up.
+	Dropped int64 `json:",omitempty"`
+}
+
+// checkFeedOrigin checks the Origin header of a handshake of the texts feed, so that the pages of other sites can't
+// open the feed from the browsers of their visitors. The Origin must be the host of the request, or one of
+// the origins, e.g. "https://moderation.example.com". A request without an Origin, as sent by the clients that are
+// not browsers, is accepted.
+func checkFeedOrigin(origins []string, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, o := range origins {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return nil
+		}
+	}
+	return errFeedOrigin
+}
+
+// isValidFeedSubscription checks if the categories are categories of the classifier and the communities are valid.
+// The default community can be selected with an empty name.
+func isValidFeedSubscription(clf classifier.Classifier, sr FeedSubscribeReq) bool {
+	for _, catg := range sr.Categories {
+		if !classifier.HasCategory(clf, catg) {
+			return false
+		}
+	}
+	for _, comm := range sr.Communities {
+		if !isValidCommunity(comm) {
+			return false
+		}
+	}
+	return true
+}
+
+// StreamTexts is an http handler that upgrades the connection to a WebSocket, and feeds it with the texts saved by
+// the pipeline, along with their categories. The client sends a FeedSubscribeReq first, which is echoed back
+// once the subscription is registered, and then receives a FeedTextResp per text. An invalid subscription
+// is answered with an error message, and the connection is closed.
+// The texts are buffered per client, as per the FeedBuffer configuration: the texts that don't fit are dropped,
+// so a slow client never slows down the pipeline. A handshake from an Origin that is neither the host of the request
+// nor one of the FeedOrigins configuration is answered with 403.
+func (h *Handler) StreamTexts(w http.ResponseWriter, r *http.Request) {
+	origins := h.settings().cf.FeedOrigins
+	srv := websocket.Server{Handler: h.streamTexts, Handshake: func(_ *websocket.Config, req *http.Request) error {
+		return checkFeedOrigin(origins, req)
+	}}
+	srv.ServeHTTP(w, r)
+}
+
+func (h *Handler) streamTexts(ws *websocket.Conn) {
+	defer ws.Close()
+	var sr FeedSubscribeReq
+	ws.SetReadDeadline(time.Now().Add(feedSubscribeTimeout))
+	if err := websocket.JSON.Receive(ws, &sr); err != nil {
+		websocket.JSON.Send(ws, "Invalid subscription")
+		return
+	}
+	if !isValidFeedSubscription(h.settings().clf, sr) {
+		websocket.JSON.Send(ws, "categories must be sentiment categories, and communities must be valid")
+		return
+	}
+	for i, comm := range sr.Communities {
+		if comm == "" {
+			sr.Communities[i] = string(database.DefaultCommunity)
+		}
+	}
+	sub := h.feed.Subscribe(stream.Filter{Categories: sr.Categories, Communities: sr.Communities},
+		h.settings().cf.FeedBuffer)
+	defer sub.Cancel()
+	if err := websocket.JSON.Send(ws, sr); err != nil {
+		return
+	}
+	// The client sends nothing after its subscription, reading detects that it has gone away.
+	ws.SetReadDeadline(time.Time{})
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-sub.Done():
+			return
+		case txt := <-sub.Texts():
+			ws.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+			if err := websocket.JSON.Send(ws, FeedTextResp{Text: txt, Dropped: sub.Dropped()}); err != nil {
+				return
+			}
+		}
+	}
+}
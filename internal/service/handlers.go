@@ -2,33 +2,82 @@ package service
 
 import (
 	"encoding/json"
-	"github.com/coderafting/panas-go/pkg/sentiment"
+	"errors"
+	"fmt"
 	"github.com/coderafting/sentiment-analysis/config"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
 	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/language"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
 	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/coderafting/sentiment-analysis/internal/stream"
 	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
 // Handler exposes the base handler for the app.
 type Handler struct {
-	db                 database.DataStore
-	cf                 config.Config
-	validTextChans     []chan pipeline.TweetText
-	processedTextChans []chan pipeline.TweetText
-	vtRoundRobin       *pipeline.MemRR
-	ptRoundRobin       *pipeline.MemRR
+	db database.DataStore
+	pl pipeline.Pipeline
+	// rt holds the runtimeSettings, they are replaced atomically by Reload.
+	rt        atomic.Value
+	reloadMux sync.Mutex
+	// loadConfig reads the configuration that is applied by the ReloadConfig handler.
+	loadConfig func() (config.Config, error)
+	// broker broadcasts the sentiment changes of the db to the clients of StreamSentiments.
+	broker *stream.Broker
+	// feed broadcasts the texts saved by the pipeline to the clients of StreamTexts.
+	feed *stream.Feed
+	// metrics exposes the metrics of the service, including the ones read from the db and the pipeline.
+	metrics http.Handler
 }
 
-// GetHandler returns an instance of handler.
-func GetHandler(db database.DataStore, c config.Config, vtc []chan pipeline.TweetText, ptc []chan pipeline.TweetText, vtr *pipeline.MemRR, ptr *pipeline.MemRR) *Handler {
-	h := Handler{db, c, vtc, ptc, vtr, ptr}
+// GetHandler returns an instance of handler, which validates the incoming texts with the supplied Classifier.
+// The languages of the incoming texts are detected among the configured languages, an invalid list of languages
+// falls back to all the supported languages. The sentiment changes of the db, and the texts saved by the
+// pipeline, are streamed if they are Observable.
+func GetHandler(db database.DataStore, c config.Config, pl pipeline.Pipeline, clf classifier.Classifier) *Handler {
+	h := Handler{db: db, pl: pl, loadConfig: config.ReloadConfig, broker: stream.NewBroker(streamHistorySize),
+		feed: stream.NewFeed()}
+	if o, ok := db.(database.Observable); ok {
+		o.Observe(h.broker.Publish)
+	}
+	if o, ok := pl.(pipeline.Observable); ok {
+		o.Observe(h.feed.Publish)
+	}
+	h.metrics = newMetrics(db, pl)
+	det, err := getDetector(c)
+	if err != nil {
+		logging.Warn("Error while detecting the configured languages, falling back to all the supported languages",
+			logging.Fields{"error": err})
+		det, _ = language.NewDetector()
+	}
+	weighting, err := getWeighting(c)
+	if err != nil {
+		logging.Warn("Error while reading the configured weighting, the texts are not weighted by their authors",
+			logging.Fields{"error": err})
+	}
+	h.rt.Store(runtimeSettings{cf: c, clf: clf, det: det, weighting: weighting})
 	return &h
 }
 
-// SaveTextReq represents a textString key of type string, incoming via http request body.
+// SaveTextReq represents a textString key of type string, incoming via http request body,
+// along with an optional community key. The texts without a community belong to the default community.
+// The optional lang key is the language of the text, as an ISO 639-1 code, it is detected if missing.
+// The optional author key is the author of the text, whose texts can be down-weighted by the configuration.
 type SaveTextReq struct {
 	TextString string
+	Community  string
+	Lang       string
+	Author     string
 }
 
 // SaveTextResp is used for creating a response object for SaveText handler.
@@ -36,37 +85,318 @@ type SaveTextResp struct {
 	Saved bool
 }
 
-// isValidText checks if the text is valid as per PANAS-t paper.
-func isValidText(txt string) bool {
-	return sentiment.ValidText(txt)
+// maxCommunityLen is the maximum length of a community name.
+const maxCommunityLen = 64
+
+// isValidCommunity checks if the community name is made of at most maxCommunityLen letters, digits, '-', '_' or '#'.
+// An empty community name is valid, it indicates the default community.
+func isValidCommunity(comm string) bool {
+	if len(comm) > maxCommunityLen {
+		return false
+	}
+	for _, c := range comm {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '#' {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidLang checks if the language is one of the languages of the detector.
+// An empty language is valid, it indicates that the language is to be detected.
+func isValidLang(det language.Detector, lang string) bool {
+	if lang == "" {
+		return true
+	}
+	for _, l := range det.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidTextReason returns why the text of the request can not be considered, i.e. its TextString is empty,
+// its Community is not valid, or its Lang is not one of the languages of the detector. It returns an empty string
+// if the text can be considered.
+func invalidTextReason(det language.Detector, tx SaveTextReq) string {
+	switch {
+	case tx.TextString == "":
+		return "TextString is empty"
+	case !isValidCommunity(tx.Community):
+		return fmt.Sprintf("Community %q is not valid, it must be made of at most %v letters, digits, '-', '_' or '#'",
+			tx.Community, maxCommunityLen)
+	case !isValidLang(det, tx.Lang):
+		return fmt.Sprintf("Lang %q is not one of the configured languages %v", tx.Lang, det.Languages())
+	}
+	return ""
+}
+
+// textLang returns the language of the request, or the language detected in its text if the request has none.
+func textLang(det language.Detector, tx SaveTextReq) string {
+	if tx.Lang != "" {
+		return tx.Lang
+	}
+	return det.Detect(tx.TextString)
+}
+
+// newTweetText creates a TweetText of a text received by the supplied request, in the supplied language.
+func newTweetText(r *http.Request, tx SaveTextReq, lang string) pipeline.TweetText {
+	return pipeline.TweetText{
+		TextString: tx.TextString,
+		ReceivedAt: time.Now().UTC(),
+		RequestID:  middleware.GetReqID(r.Context()),
+		Community:  tx.Community,
+		Lang:       lang,
+		Author:     tx.Author,
+	}
 }
 
 // SaveText is an http handler that saves the incoming text in DB,
 // update the corresponding sentiment, and returns success object.
 func (h *Handler) SaveText(w http.ResponseWriter, r *http.Request) {
+	textsReceived.Inc()
 	var tx SaveTextReq
 	err := json.NewDecoder(r.Body).Decode(&tx)
 	if err != nil {
+		textsInvalid.Inc()
 		utils.JSONErrorResponse(w, err.Error())
 		return
 	}
-	if tx.TextString == "" {
-		utils.JSONErrorResponse(w, "Invalid body params")
+	rt := h.settings()
+	if reason := invalidTextReason(rt.det, tx); reason != "" {
+		textsInvalid.Inc()
+		utils.JSONErrorResponse(w, reason)
 		return
 	}
-	if isValidText(tx.TextString) {
-		go pipeline.PubValidText(pipeline.TweetText{TextString: tx.TextString}, h.validTextChans, h.vtRoundRobin)
+	lang := textLang(rt.det, tx)
+	if classifier.ForLanguage(rt.clf, lang).Validate(tx.TextString) {
+		textsValid.Inc()
+		if err := h.pl.Submit(r.Context(), newTweetText(r, tx, lang)); err != nil {
+			h.submitErrorResponse(w, err)
+			return
+		}
 		data := SaveTextResp{Saved: true}
 		utils.JSONSuccessResponse(w, data)
 	} else {
+		textsInvalid.Inc()
 		data := SaveTextResp{Saved: false}
 		utils.JSONSuccessResponse(w, data)
 	}
 }
 
+// submitErrorResponse creates an http response object for an error returned by the pipeline's Submit.
+func (h *Handler) submitErrorResponse(w http.ResponseWriter, err error) {
+	switch err {
+	case pipeline.ErrSaturated:
+		h.setRetryAfter(w)
+		utils.JSONTooManyRequestsResponse(w, err.Error())
+	case pipeline.ErrStopped:
+		utils.JSONUnavailableResponse(w, err.Error())
+	default:
+		utils.JSONErrorResponse(w, err.Error())
+	}
+}
+
+// setRetryAfter sets the Retry-After header, in seconds, based on the RetryAfter configuration.
+func (h *Handler) setRetryAfter(w http.ResponseWriter) {
+	retryAfter := int(math.Ceil(h.settings().cf.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+}
+
+// fetchErrorResponse creates an http response object for an error returned by a fetch from the db.
+// It responds with 404 if the category or the community doesn't exist.
+func fetchErrorResponse(w http.ResponseWriter, err error) {
+	if errors.Is(err, classifier.ErrUnknownCategory) || errors.Is(err, database.ErrUnknownCommunity) {
+		utils.JSONNotFoundResponse(w, err.Error())
+		return
+	}
+	utils.JSONErrorResponse(w, err.Error())
+}
+
+// checkCategory returns an error if the category is not one of the categories of the classifier.
+// An empty category is valid, it selects all the categories.
+func (h *Handler) checkCategory(catg string) error {
+	if catg != "" && !classifier.HasCategory(h.settings().clf, catg) {
+		return fmt.Errorf("Category %v doesn't exist: %w", catg, classifier.ErrUnknownCategory)
+	}
+	return nil
+}
+
 // GetSentiments is an http handler that returns all the sentiments, category-wise, from the db.
+// The community query param, if supplied, selects the sentiments of a single community.
+// If a baseline has been frozen, every sentiment also carries its relative change against the baseline.
+// The breakdown=lang query param adds the sentiments of every language.
 func (h *Handler) GetSentiments(w http.ResponseWriter, r *http.Request) {
-	data, err := h.db.FetchSentiments()
+	comm := database.Community(r.URL.Query().Get("community"))
+	data, err := h.db.FetchSentiments(comm)
+	if err != nil {
+		fetchErrorResponse(w, err)
+		return
+	}
+	h.sentimentsResponse(w, r, comm, withBaseline(data, h.baseline(comm)))
+}
+
+// sentimentsResponse responds with the sentiments, broken down by language if the breakdown query param is lang.
+// It responds with 400 if the breakdown query param is neither empty nor lang.
+func (h *Handler) sentimentsResponse(w http.ResponseWriter, r *http.Request, comm database.Community, resp map[database.Category]SentimentResp) {
+	switch r.URL.Query().Get("breakdown") {
+	case "":
+	case "lang":
+		langs, err := h.db.FetchLanguageSentiments(comm)
+		if err != nil {
+			fetchErrorResponse(w, err)
+			return
+		}
+		for c, sr := range resp {
+			sr.Languages = map[string]SentimentResp{}
+			for lang, sents := range langs {
+				if s, ok := sents[c]; ok {
+					sr.Languages[lang] = SentimentResp{Value: s.Value, TextCount: s.TextCount, WeightedCount: s.WeightedCount}
+				}
+			}
+			resp[c] = sr
+		}
+	default:
+		utils.JSONErrorResponse(w, "breakdown must be lang")
+		return
+	}
+	utils.JSONSuccessResponse(w, resp)
+}
+
+// GetCommunities is an http handler that returns the communities in which some texts have been received.
+func (h *Handler) GetCommunities(w http.ResponseWriter, r *http.Request) {
+	data, err := h.db.FetchCommunities()
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	utils.JSONSuccessResponse(w, data)
+}
+
+// defaultSeriesRange is the range of the time-series returned by GetTimeSeries, when the from param is missing.
+const defaultSeriesRange = 24 * time.Hour
+
+// GetTimeSeries is an http handler that returns the sentiments computed per time bucket.
+// The from and to query params (RFC3339) select the range, which defaults to the last 24 hours.
+// The bucket query param (minute, hour, or day) defaults to the DefaultBucket configuration,
+// the category query param, if supplied, selects a single sentiment category,
+// and the community query param, if supplied, selects the history of a single community.
+func (h *Handler) GetTimeSeries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := database.SeriesQuery{
+		To:        time.Now().UTC(),
+		Bucket:    database.BucketWidth(h.settings().cf.DefaultBucket),
+		Category:  params.Get("category"),
+		Community: database.Community(params.Get("community")),
+	}
+	if b := params.Get("bucket"); b != "" {
+		q.Bucket = database.BucketWidth(b)
+	}
+	var err error
+	if to := params.Get("to"); to != "" {
+		if q.To, err = time.Parse(time.RFC3339, to); err != nil {
+			utils.JSONErrorResponse(w, fmt.Sprintf("to must be an RFC3339 time: %v", err))
+			return
+		}
+	}
+	q.From = q.To.Add(-defaultSeriesRange)
+	if from := params.Get("from"); from != "" {
+		if q.From, err = time.Parse(time.RFC3339, from); err != nil {
+			utils.JSONErrorResponse(w, fmt.Sprintf("from must be an RFC3339 time: %v", err))
+			return
+		}
+	}
+	if !q.From.Before(q.To) {
+		utils.JSONErrorResponse(w, "from must be before to")
+		return
+	}
+	if err := h.checkCategory(q.Category); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	data, err := h.db.FetchTimeSeries(q)
+	if errors.Is(err, database.ErrUnknownCommunity) {
+		utils.JSONNotFoundResponse(w, err.Error())
+		return
+	}
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	utils.JSONSuccessResponse(w, seriesWithBaseline(data, h.baseline(q.Community)))
+}
+
+// GetCategorySentiments is an http handler that returns the sentiment of the category supplied in the url.
+// It responds with 404 if the category is not one of the categories of the classifier.
+// The community query param, if supplied, selects the sentiment of the category within a single community,
+// and the breakdown=lang query param adds the sentiment of the category within every language.
+func (h *Handler) GetCategorySentiments(w http.ResponseWriter, r *http.Request) {
+	comm := database.Community(r.URL.Query().Get("community"))
+	catg := chi.URLParam(r, "category")
+	if err := h.checkCategory(catg); err != nil {
+		fetchErrorResponse(w, err)
+		return
+	}
+	data, err := h.db.FetchCategorySentiments(comm, catg)
+	if err != nil {
+		fetchErrorResponse(w, err)
+		return
+	}
+	h.sentimentsResponse(w, r, comm, withBaseline(data, h.baseline(comm)))
+}
+
+// Page sizes of the GetTexts handler.
+const (
+	defaultTextsLimit = 50
+	maxTextsLimit     = 500
+)
+
+// GetText is an http handler that returns the text with the ID supplied in the url.
+func (h *Handler) GetText(w http.ResponseWriter, r *http.Request) {
+	data, err := h.db.FetchText(database.ID(chi.URLParam(r, "id")))
+	if errors.Is(err, database.ErrTextNotFound) {
+		utils.JSONNotFoundResponse(w, err.Error())
+		return
+	}
+	if err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	utils.JSONSuccessResponse(w, data)
+}
+
+// GetTexts is an http handler that returns a page of the stored texts, in their insertion order.
+// The texts can be filtered with the category, community, lang, and contains (a case-insensitive substring) query params.
+// The page size is set by the limit query param, and the next page is fetched by supplying
+// the NextCursor of the response as the cursor query param.
+func (h *Handler) GetTexts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit := defaultTextsLimit
+	if l := params.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > maxTextsLimit {
+			utils.JSONErrorResponse(w, fmt.Sprintf("limit must be a number between 1 and %v", maxTextsLimit))
+			return
+		}
+	}
+	q := database.TextQuery{
+		Category:  params.Get("category"),
+		Community: database.Community(params.Get("community")),
+		Contains:  params.Get("contains"),
+		Lang:      params.Get("lang"),
+		Cursor:    params.Get("cursor"),
+		Limit:     limit,
+	}
+	if err := h.checkCategory(q.Category); err != nil {
+		utils.JSONErrorResponse(w, err.Error())
+		return
+	}
+	data, err := h.db.FetchTexts(q)
 	if err != nil {
 		utils.JSONErrorResponse(w, err.Error())
 		return
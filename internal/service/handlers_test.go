@@ -1,13 +1,23 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/coderafting/sentiment-analysis/config"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
 	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
 	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/websocket"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -22,7 +32,7 @@ func TestIsValidText(t *testing.T) {
 		testCase{txt: "It is a happy day", expected: false},
 	}
 	for _, c := range cases {
-		out := isValidText(c.txt)
+		out := classifier.Panas{}.Validate(c.txt)
 		if c.expected != out {
 			t.Errorf("Failed: expected %v, got: %v", c.expected, out)
 		}
@@ -32,11 +42,8 @@ func TestIsValidText(t *testing.T) {
 func TestSaveText(t *testing.T) {
 	var mockDB = database.GetDatastore()
 	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
-	var mockVTPIndex = pipeline.MemRR{Index: 0}
-	var mockPTPIndex = pipeline.MemRR{Index: 0}
-	var mockVTParts = pipeline.MemPartitions(4, 10)
-	var mockPTParts = pipeline.MemPartitions(4, 10)
-	var mockHandler = GetHandler(mockDB, mockConfig, mockVTParts, mockPTParts, &mockVTPIndex, &mockPTPIndex)
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
 
 	reqData := SaveTextReq{TextString: "I am happy"}
 	jsonReq, _ := json.Marshal(reqData)
@@ -53,22 +60,38 @@ func TestSaveText(t *testing.T) {
 	time.Sleep(2 * time.Second) // just for a simplified testing
 	expectedResp, _ := json.Marshal(SaveTextResp{Saved: true})
 	expectedRespStr := bytes.NewBuffer(expectedResp).String()
-	expected, _ := mockDB.FetchCategorySentiments("jovility")
+	expected, _ := mockDB.FetchCategorySentiments("", "jovility")
 	if respRec.Body.String() != expectedRespStr && expected["jovility"].TextCount != 0 {
 		t.Errorf("handler returned unexpected body: got %v want %v", respRec.Body.String(), expected)
 	}
+
+	type testCase struct {
+		body     string
+		expected string
+	}
+	cases := []testCase{
+		testCase{body: `{"textString": ""}`, expected: `"TextString is empty"`},
+		testCase{body: `{"textString": "I am happy", "community": "#mon day"}`,
+			expected: `"Community \"#mon day\" is not valid, it must be made of at most 64 letters, digits, '-', '_' or '#'"`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("POST", "/text", strings.NewReader(c.body))
+		respRec := httptest.NewRecorder()
+		handler.ServeHTTP(respRec, req)
+		if respRec.Code != http.StatusBadRequest || respRec.Body.String() != c.expected {
+			t.Errorf("handler returned unexpected response for %v: got %v %v, expected %v", c.body, respRec.Code,
+				respRec.Body.String(), c.expected)
+		}
+	}
 }
 
 func TestGetSentiments(t *testing.T) {
 	var mockDB = database.GetDatastore()
 	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
-	var mockVTPIndex = pipeline.MemRR{Index: 0}
-	var mockPTPIndex = pipeline.MemRR{Index: 0}
-	var mockVTParts = pipeline.MemPartitions(4, 10)
-	var mockPTParts = pipeline.MemPartitions(4, 10)
-	var mockHandler = GetHandler(mockDB, mockConfig, mockVTParts, mockPTParts, &mockVTPIndex, &mockPTPIndex)
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
 
-	mockDB.UpdateSentiment("jovility", 1)
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
 	req, err := http.NewRequest("GET", "/sentiments", nil)
 	if err != nil {
 		t.Fatal(err)
@@ -82,9 +105,1058 @@ func TestGetSentiments(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := `{"jovility":{"Value":1,"TextCount":1}}`
+	expected := `{"jovility":{"Value":1,"TextCount":1,"WeightedCount":1}}`
 	if respRec.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v, expected %v",
 			respRec.Body.String(), expected)
 	}
 }
+
+func TestShutdownDrainsPipeline(t *testing.T) {
+	a := App{Cf: config.Config{Port: ":0", Partitions: 2, PartitionBuffer: 1, ShutdownTimeout: 5 * time.Second}}
+	a.init()
+	texts := []string{"I am happy", "I feel happy", "I am sad", "I am scared"}
+	for _, txt := range texts {
+		jsonReq, _ := json.Marshal(SaveTextReq{TextString: txt})
+		req, _ := http.NewRequest("POST", "/text", bytes.NewBuffer(jsonReq))
+		req.Header.Set("Content-Type", "application/json")
+		a.r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := a.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := a.pl.Stats(); stats.Saved != int64(len(texts)) || stats.Dropped != 0 {
+		t.Errorf("Failed: expected Saved: %v and Dropped: %v, recieved %v and %v", len(texts), 0, stats.Saved, stats.Dropped)
+	}
+	out, _ := a.db.FetchCategorySentiments("", "jovility")
+	if out["jovility"].TextCount != 2 {
+		t.Errorf("Failed: expected: %v, recieved %v", 2, out["jovility"].TextCount)
+	}
+}
+
+func TestFreezeConfiguredBaseline(t *testing.T) {
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// The window is over, the baseline is frozen right away.
+	db := database.GetDatastore()
+	db.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: day})
+	freezeConfiguredBaseline(db, config.BaselineConfig{From: day, To: day.Add(24 * time.Hour)}, stop)
+	if b, err := db.FetchBaseline(""); err != nil || b.TotalTexts != 1 {
+		t.Errorf("Failed: expected a baseline of 1 text, got %+v, %v", b, err)
+	}
+
+	// A stored baseline is kept.
+	freezeConfiguredBaseline(db, config.BaselineConfig{From: day, To: day.Add(time.Hour)}, stop)
+	if b, _ := db.FetchBaseline(""); !b.To.Equal(day.Add(24 * time.Hour)) {
+		t.Errorf("Failed: expected the stored baseline to be kept, got %+v", b)
+	}
+
+	// The window is not over, or not started, the baseline is not frozen until it is over.
+	for _, bc := range []config.BaselineConfig{config.BaselineConfig{FirstDays: 1}, config.BaselineConfig{From: day, To: time.Now().Add(time.Hour)}} {
+		db := database.GetDatastore()
+		db.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+		quit := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			freezeConfiguredBaseline(db, bc, quit)
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if _, err := db.FetchBaseline(""); err != database.ErrNoBaseline {
+			t.Errorf("Failed: expected no baseline for %+v, got %v", bc, err)
+		}
+		close(quit)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("Failed: the freeze of %+v was not stopped", bc)
+		}
+	}
+}
+
+func TestSaveTextSaturated(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 1, PartitionBuffer: 1, RetryAfter: 2 * time.Second}
+	// The pipeline is not started, the second text can not be admitted.
+	var mockPipeline = pipeline.GetMemPipeline(1, 1, pipeline.Admission{Policy: pipeline.Reject, Timeout: 10 * time.Millisecond}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		jsonReq, _ := json.Marshal(SaveTextReq{TextString: "I am happy"})
+		req, _ := http.NewRequest("POST", "/text", bytes.NewBuffer(jsonReq))
+		respRec := httptest.NewRecorder()
+		http.HandlerFunc(mockHandler.SaveText).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != expected {
+			t.Errorf("request %v returned wrong status code: got %v want %v", i, status, expected)
+		}
+	}
+}
+
+func TestSaveTexts(t *testing.T) {
+	type testCase struct {
+		body     string
+		accepted int
+		invalid  int
+		statuses []string
+	}
+	cases := []testCase{
+		testCase{
+			body:     `[{"textString": "I am happy"}, {"textString": "It is a happy day"}, {"textString": 1}, {"textString": "I feel sad"}]`,
+			accepted: 2, invalid: 2,
+			statuses: []string{batchAccepted, batchInvalid, batchInvalid, batchAccepted},
+		},
+		testCase{
+			body:     "{\"textString\": \"I am happy\"}\n\n{\"textString\": \"\"}\n{\"textString\": \"I am tired\"}\n",
+			accepted: 2, invalid: 1,
+			statuses: []string{batchAccepted, batchInvalid, batchAccepted},
+		},
+	}
+	for _, c := range cases {
+		var mockDB = database.GetDatastore()
+		var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+		var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+		var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+
+		req, _ := http.NewRequest("POST", "/texts/batch", bytes.NewBufferString(c.body))
+		respRec := httptest.NewRecorder()
+		http.HandlerFunc(mockHandler.SaveTexts).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		var resp SaveTextsResp
+		json.Unmarshal(respRec.Body.Bytes(), &resp)
+		if resp.Accepted != c.accepted || resp.Invalid != c.invalid || resp.Rejected != 0 || len(resp.Results) != len(c.statuses) {
+			t.Fatalf("handler returned unexpected body: got %v", respRec.Body.String())
+		}
+		for i, status := range c.statuses {
+			if resp.Results[i].Index != i || resp.Results[i].Status != status {
+				t.Errorf("handler returned unexpected result: got %v want %v", resp.Results[i], status)
+			}
+		}
+		if submitted := mockPipeline.Stats().Submitted; submitted != int64(c.accepted) {
+			t.Errorf("Failed: expected %v submitted texts, recieved %v", c.accepted, submitted)
+		}
+	}
+}
+
+func TestSaveTextsTooLarge(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, BatchMaxItems: 1}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+
+	req, _ := http.NewRequest("POST", "/texts/batch", bytes.NewBufferString(`[{"textString": "I am happy"}, {"textString": "I am sad"}]`))
+	respRec := httptest.NewRecorder()
+	http.HandlerFunc(mockHandler.SaveTexts).ServeHTTP(respRec, req)
+	if status := respRec.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestGetCategorySentiments(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+
+	type testCase struct {
+		url      string
+		status   int
+		expected string
+	}
+	cases := []testCase{
+		testCase{url: "/sentiments/jovility", status: http.StatusOK, expected: `{"jovility":{"Value":1,"TextCount":1,"WeightedCount":1}}`},
+		testCase{url: "/sentiments/sadness", status: http.StatusOK, expected: `{"sadness":{"Value":0,"TextCount":0,"WeightedCount":0}}`},
+		testCase{url: "/sentiments/boredom", status: http.StatusNotFound, expected: `"Category boredom doesn't exist: unknown category"`},
+		testCase{url: "/sentiments/jovility?community=default", status: http.StatusOK, expected: `{"jovility":{"Value":1,"TextCount":1,"WeightedCount":1}}`},
+		testCase{url: "/sentiments/jovility?community=cats", status: http.StatusNotFound, expected: `"Community cats doesn't exist: unknown community"`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, c.status)
+		}
+		if respRec.Body.String() != c.expected {
+			t.Errorf("handler returned unexpected body: got %v, expected %v", respRec.Body.String(), c.expected)
+		}
+	}
+}
+
+func TestGetTexts(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	happy, _ := mockDB.InsertText(database.Text{TextString: "I am happy", Categories: []database.Category{"jovility"}})
+	mockDB.InsertText(database.Text{TextString: "I am sad", Categories: []database.Category{"sadness"}})
+	mockDB.InsertText(database.Text{TextString: "I feel happy", Categories: []database.Category{"jovility"}})
+
+	type testCase struct {
+		url    string
+		status int
+		texts  int
+		cursor bool
+	}
+	cases := []testCase{
+		testCase{url: "/texts", status: http.StatusOK, texts: 3},
+		testCase{url: "/texts?category=jovility&limit=1", status: http.StatusOK, texts: 1, cursor: true},
+		testCase{url: "/texts?contains=SAD", status: http.StatusOK, texts: 1},
+		testCase{url: "/texts?category=boredom", status: http.StatusBadRequest},
+		testCase{url: "/texts?limit=0", status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v returned wrong status code: got %v want %v", c.url, status, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var page database.TextPage
+		json.Unmarshal(respRec.Body.Bytes(), &page)
+		if len(page.Texts) != c.texts || (page.NextCursor != "") != c.cursor {
+			t.Errorf("%v returned unexpected body: %v", c.url, respRec.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/texts/"+string(happy.ID), nil)
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	expected, _ := json.Marshal(happy)
+	if respRec.Code != http.StatusOK || respRec.Body.String() != string(expected) {
+		t.Errorf("handler returned unexpected response: got %v %v, expected %v", respRec.Code, respRec.Body.String(), string(expected))
+	}
+	req, _ = http.NewRequest("GET", "/texts/missing", nil)
+	respRec = httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	if respRec.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", respRec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetTimeSeries(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, DefaultBucket: "hour"}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(10 * time.Minute)})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "fear", Count: 1, At: day.Add(20 * time.Minute)})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "fear", Count: 1, At: day.Add(90 * time.Minute)})
+
+	type testCase struct {
+		url     string
+		status  int
+		buckets int
+	}
+	cases := []testCase{
+		testCase{url: "/sentiments/timeseries?from=2020-09-01T00:00:00Z&to=2020-09-02T00:00:00Z", status: http.StatusOK, buckets: 2},
+		testCase{url: "/sentiments/timeseries?from=2020-09-01T00:00:00Z&to=2020-09-02T00:00:00Z&bucket=minute&category=fear", status: http.StatusOK, buckets: 3},
+		testCase{url: "/sentiments/timeseries?from=2020-09-01T00:00:00Z&to=2020-09-02T00:00:00Z&bucket=day", status: http.StatusOK, buckets: 1},
+		testCase{url: "/sentiments/timeseries", status: http.StatusOK, buckets: 0},
+		testCase{url: "/sentiments/timeseries?bucket=week", status: http.StatusBadRequest},
+		testCase{url: "/sentiments/timeseries?category=boredom", status: http.StatusBadRequest},
+		testCase{url: "/sentiments/timeseries?from=yesterday", status: http.StatusBadRequest},
+		testCase{url: "/sentiments/timeseries?from=2020-09-02T00:00:00Z&to=2020-09-01T00:00:00Z", status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v returned wrong status code: got %v want %v", c.url, status, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var series []database.SeriesBucket
+		json.Unmarshal(respRec.Body.Bytes(), &series)
+		if len(series) != c.buckets {
+			t.Errorf("%v returned unexpected body: %v", c.url, respRec.Body.String())
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, DefaultBucket: "hour"}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(10 * time.Minute)})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "fear", Count: 1, At: day.Add(20 * time.Minute)})
+
+	type testCase struct {
+		method string
+		url    string
+		body   string
+		status int
+		resp   string
+	}
+	cases := []testCase{
+		testCase{method: "GET", url: "/baseline", status: http.StatusNotFound, resp: `"no baseline"`},
+		testCase{method: "POST", url: "/baseline", body: `{"From":"2020-09-02T00:00:00Z","To":"2020-09-01T00:00:00Z"}`, status: http.StatusBadRequest},
+		testCase{method: "POST", url: "/baseline", body: `{"FirstDays":1}`, status: http.StatusOK},
+		testCase{method: "GET", url: "/baseline", status: http.StatusOK},
+		testCase{method: "GET", url: "/sentiments/jovility", status: http.StatusOK, resp: `{"jovility":{"Value":0.5,"TextCount":1,"WeightedCount":1,"Baseline":0.5,"Relative":0}}`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", c.method, c.url, status, c.status)
+		}
+		if c.resp != "" && strings.TrimSpace(respRec.Body.String()) != c.resp {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", c.method, c.url, respRec.Body.String(), c.resp)
+		}
+	}
+
+	// The relative change tracks the sentiments received after the baseline period.
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(25 * time.Hour)})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: day.Add(26 * time.Hour)})
+	req, _ := http.NewRequest("GET", "/sentiments", nil)
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	var sents map[database.Category]SentimentResp
+	json.Unmarshal(respRec.Body.Bytes(), &sents)
+	if jov := sents["jovility"]; jov.Relative == nil || *jov.Relative != 0.5 {
+		t.Errorf("GET /sentiments returned unexpected body: %v", respRec.Body.String())
+	}
+
+	// The baseline of a community is frozen, and applied, separately.
+	mockDB.UpdateSentiment(database.SentimentUpdate{Community: "cats", Category: "fear", Count: 1, At: day})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Community: "cats", Category: "fear", Count: 1, At: day.Add(25 * time.Hour)})
+	mockDB.UpdateSentiment(database.SentimentUpdate{Community: "cats", Category: "jovility", Count: 2, At: day.Add(25 * time.Hour)})
+	communityCases := []testCase{
+		testCase{method: "GET", url: "/baseline?community=cats", status: http.StatusNotFound, resp: `"no baseline"`},
+		testCase{method: "GET", url: "/sentiments/fear?community=cats", status: http.StatusOK,
+			resp: `{"fear":{"Value":0.5,"TextCount":2,"WeightedCount":2}}`},
+		testCase{method: "POST", url: "/baseline", body: `{"FirstDays":1,"Community":"birds"}`, status: http.StatusNotFound},
+		testCase{method: "POST", url: "/baseline", body: `{"FirstDays":1,"Community":"cats"}`, status: http.StatusOK},
+		testCase{method: "GET", url: "/sentiments/fear?community=cats", status: http.StatusOK,
+			resp: `{"fear":{"Value":0.5,"TextCount":2,"WeightedCount":2,"Baseline":1,"Relative":-0.5}}`},
+		testCase{method: "GET", url: "/baseline?community=birds", status: http.StatusNotFound},
+	}
+	for _, c := range communityCases {
+		req, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v %v returned wrong status code: got %v want %v", c.method, c.url, status, c.status)
+		}
+		if c.resp != "" && strings.TrimSpace(respRec.Body.String()) != c.resp {
+			t.Errorf("%v %v returned unexpected body: got %v want %v", c.method, c.url, respRec.Body.String(), c.resp)
+		}
+	}
+}
+
+func TestCommunities(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, DefaultBucket: "hour"}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	mockPipeline.Start()
+	bodies := []string{
+		`{"textString": "I feel happy", "community": "cats"}`,
+		`{"textString": "I feel sad", "community": "dogs"}`,
+		`{"textString": "I feel happy", "community": "dogs"}`,
+		`{"textString": "I feel happy", "community": "cats and dogs"}`,
+	}
+	for _, b := range bodies {
+		req, _ := http.NewRequest("POST", "/text", strings.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+	}
+	mockPipeline.Stop(context.Background())
+
+	type testCase struct {
+		url      string
+		status   int
+		expected string
+	}
+	cases := []testCase{
+		testCase{url: "/communities", status: http.StatusOK, expected: `["cats","dogs"]`},
+		testCase{url: "/sentiments?community=cats", status: http.StatusOK, expected: `{"jovility":{"Value":1,"TextCount":1,"WeightedCount":1}}`},
+		testCase{url: "/sentiments?community=dogs", status: http.StatusOK, expected: `{"jovility":{"Value":0.5,"TextCount":1,"WeightedCount":1},"sadness":{"Value":0.5,"TextCount":1,"WeightedCount":1}}`},
+		testCase{url: "/sentiments?community=birds", status: http.StatusNotFound, expected: `"Community birds doesn't exist: unknown community"`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v returned wrong status code: got %v want %v", c.url, status, c.status)
+		}
+		if respRec.Body.String() != c.expected {
+			t.Errorf("%v returned unexpected body: got %v, expected %v", c.url, respRec.Body.String(), c.expected)
+		}
+	}
+}
+
+func TestCompareSentiments(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	day := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	// cats: 30 fear out of 100, dogs: 20 fear out of 100, on the first day. dogs: 30 fear out of 100 on the second day.
+	add := func(comm database.Community, catg string, count int, at time.Time) {
+		mockDB.UpdateSentiment(database.SentimentUpdate{Community: comm, Category: catg, Count: count, At: at})
+	}
+	add("cats", "fear", 30, day)
+	add("cats", "jovility", 70, day)
+	add("dogs", "fear", 20, day)
+	add("dogs", "jovility", 80, day)
+	add("dogs", "fear", 300, day.Add(24*time.Hour))
+	add("dogs", "jovility", 700, day.Add(24*time.Hour))
+
+	type testCase struct {
+		url         string
+		status      int
+		fearDiff    float64
+		significant bool
+	}
+	cases := []testCase{
+		testCase{url: "/sentiments/compare?a=cats&b=dogs&toB=2020-09-02T00:00:00Z&fromB=2020-09-01T00:00:00Z", status: http.StatusOK, fearDiff: 0.1},
+		testCase{url: "/sentiments/compare?a=dogs&fromA=2020-09-02T00:00:00Z&toA=2020-09-03T00:00:00Z&b=dogs&fromB=2020-09-01T00:00:00Z&toB=2020-09-02T00:00:00Z", status: http.StatusOK, fearDiff: 0.1, significant: true},
+		testCase{url: "/sentiments/compare?a=cats&b=dogs&confidence=0.8", status: http.StatusOK, fearDiff: 0.3 - 320.0/1100, significant: false},
+		testCase{url: "/sentiments/compare?a=cats&b=birds", status: http.StatusNotFound},
+		testCase{url: "/sentiments/compare?a=cats&b=dogs&fromB=2020-09-01T00:00:00Z", status: http.StatusBadRequest},
+		testCase{url: "/sentiments/compare?a=cats&b=dogs&fromB=2020-09-05T00:00:00Z&toB=2020-09-06T00:00:00Z", status: http.StatusBadRequest},
+		testCase{url: "/sentiments/compare?a=cats&b=dogs&confidence=2", status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if status := respRec.Code; status != c.status {
+			t.Errorf("%v returned wrong status code: got %v want %v", c.url, status, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var resp CompareResp
+		json.Unmarshal(respRec.Body.Bytes(), &resp)
+		fear := resp.Categories["fear"]
+		if math.Abs(fear.Difference-c.fearDiff) > 1e-9 || fear.Significant != c.significant || fear.Lower > fear.Difference || fear.Upper < fear.Difference {
+			t.Errorf("%v returned unexpected body: %v", c.url, respRec.Body.String())
+		}
+	}
+}
+
+// acceptAll is a Classifier that validates every text, and categorizes it with the Panas classifier.
+type acceptAll struct {
+	classifier.Panas
+}
+
+func (acceptAll) Validate(txt string) bool {
+	return true
+}
+
+func TestSaveTextClassifier(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, acceptAll{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, acceptAll{})
+	mockPipeline.Start()
+	req, _ := http.NewRequest("POST", "/text", strings.NewReader(`{"textString": "It is a happy day"}`))
+	req.Header.Set("Content-Type", "application/json")
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	mockPipeline.Stop(context.Background())
+	if expected := `{"Saved":true}`; respRec.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v, expected %v", respRec.Body.String(), expected)
+	}
+	if sents, _ := mockDB.FetchSentiments(""); sents["jovility"].TextCount != 1 {
+		t.Errorf("Failed: expected the text to be saved, got %v", sents)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, Classifier: "panas", AdminToken: "secret"}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	mockPipeline.Start()
+	defer mockPipeline.Stop(context.Background())
+	postWithToken := func(url string, body string, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		return respRec
+	}
+	post := func(url string, body string) *httptest.ResponseRecorder {
+		return postWithToken(url, body, "secret")
+	}
+	if body := post("/text", `{"textString": "I am hyped"}`).Body.String(); body != `{"Saved":false}` {
+		t.Errorf("handler returned unexpected body before the reload: %v", body)
+	}
+
+	// The reload requires the admin token.
+	mockHandler.loadConfig = func() (config.Config, error) {
+		t.Errorf("Failed: expected the configuration not to be read without the admin token")
+		return mockConfig, nil
+	}
+	for _, token := range []string{"", "wrong"} {
+		if respRec := postWithToken("/admin/reload", "", token); respRec.Code != http.StatusUnauthorized {
+			t.Errorf("handler returned wrong status code for token %q: got %v want %v", token, respRec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// An invalid configuration is not applied.
+	invalid := mockConfig
+	invalid.Classifier = "vader"
+	mockHandler.loadConfig = func() (config.Config, error) { return invalid, nil }
+	if respRec := post("/admin/reload", ""); respRec.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", respRec.Code, http.StatusInternalServerError)
+	}
+
+	reloaded := mockConfig
+	reloaded.Lexicons = []string{"../classifier/testdata/gaming.yml"}
+	reloaded.RetryAfter = 5 * time.Second
+	reloaded.Partitions = 8
+	mockHandler.loadConfig = func() (config.Config, error) { return reloaded, nil }
+	respRec := post("/admin/reload", "")
+	expected := `{"Reloaded":["RetryAfter","Lexicons"],"RestartRequired":["Partitions"]}`
+	if respRec.Code != http.StatusOK || respRec.Body.String() != expected {
+		t.Errorf("handler returned unexpected response: got %v %v, expected %v", respRec.Code, respRec.Body.String(), expected)
+	}
+	if body := post("/text", `{"textString": "I am hyped"}`).Body.String(); body != `{"Saved":true}` {
+		t.Errorf("handler returned unexpected body after the reload: %v", body)
+	}
+	if cf := mockHandler.settings().cf; cf.Partitions != 4 || cf.RetryAfter != 5*time.Second {
+		t.Errorf("Failed: expected the reloadable settings only to be applied, got %+v", cf)
+	}
+
+	// The admin endpoints are disabled without an admin token.
+	var disabledDB = database.GetDatastore()
+	var disabledHandler = GetHandler(disabledDB, config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10},
+		pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, disabledDB), classifier.Panas{})
+	req, _ := http.NewRequest("POST", "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	respRec = httptest.NewRecorder()
+	Routes(disabledHandler).ServeHTTP(respRec, req)
+	if respRec.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", respRec.Code, http.StatusForbidden)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	clf, err := getClassifier(mockConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, clf, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, clf)
+	mockPipeline.Start()
+	type postCase struct {
+		body     string
+		status   int
+		expected string
+	}
+	posts := []postCase{
+		postCase{body: `{"textString": "Estoy muy feliz hoy"}`, status: http.StatusOK, expected: `{"Saved":true}`},
+		postCase{body: `{"textString": "Eu estou tão cansada"}`, status: http.StatusOK, expected: `{"Saved":true}`},
+		postCase{body: `{"textString": "I feel happy"}`, status: http.StatusOK, expected: `{"Saved":true}`},
+		postCase{body: `{"textString": "I feel happy", "lang": "es"}`, status: http.StatusOK, expected: `{"Saved":false}`},
+		postCase{body: `{"textString": "Je suis content", "lang": "fr"}`, status: http.StatusBadRequest,
+			expected: `"Lang \"fr\" is not one of the configured languages [en es pt]"`},
+	}
+	for _, c := range posts {
+		req, _ := http.NewRequest("POST", "/text", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if respRec.Code != c.status || respRec.Body.String() != c.expected {
+			t.Errorf("POST /text returned unexpected response for %v: got %v %v", c.body, respRec.Code, respRec.Body.String())
+		}
+	}
+	mockPipeline.Stop(context.Background())
+
+	req, _ := http.NewRequest("GET", "/sentiments?breakdown=lang", nil)
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	var sents map[string]SentimentResp
+	if err := json.Unmarshal(respRec.Body.Bytes(), &sents); err != nil {
+		t.Fatal(err)
+	}
+	jov, fat := sents["jovility"], sents["fatigue"]
+	if jov.TextCount != 2 || len(jov.Languages) != 2 || jov.Languages["es"].TextCount != 1 || jov.Languages["en"].Value != 1 {
+		t.Errorf("GET /sentiments returned unexpected jovility: %v", respRec.Body.String())
+	}
+	if len(fat.Languages) != 1 || fat.Languages["pt"].WeightedCount != 1.5 {
+		t.Errorf("GET /sentiments returned unexpected fatigue: %v", respRec.Body.String())
+	}
+	type getCase struct {
+		url      string
+		status   int
+		expected string
+	}
+	gets := []getCase{
+		getCase{url: "/sentiments/fatigue?breakdown=lang", status: http.StatusOK,
+			expected: `{"fatigue":{"Value":0.375,"TextCount":1,"WeightedCount":1.5,"Languages":{"pt":{"Value":1,"TextCount":1,"WeightedCount":1.5}}}}`},
+		getCase{url: "/sentiments?breakdown=community", status: http.StatusBadRequest, expected: `"breakdown must be lang"`},
+	}
+	for _, c := range gets {
+		req, _ := http.NewRequest("GET", c.url, nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if respRec.Code != c.status || respRec.Body.String() != c.expected {
+			t.Errorf("%v returned unexpected response: got %v %v, expected %v", c.url, respRec.Code, respRec.Body.String(), c.expected)
+		}
+	}
+	req, _ = http.NewRequest("GET", "/texts?lang=pt", nil)
+	respRec = httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	if !strings.Contains(respRec.Body.String(), `"Lang":"pt"`) || strings.Contains(respRec.Body.String(), `"Lang":"es"`) {
+		t.Errorf("GET /texts?lang=pt returned unexpected body: %v", respRec.Body.String())
+	}
+}
+
+func TestAuthorWeights(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, SplitCategories: true,
+		AuthorWeights: map[string]float64{"bot": 0}}
+	weighting, err := getWeighting(mockConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, weighting, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	mockPipeline.Start()
+	post := func(url string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		return respRec
+	}
+	post("/text", `{"textString": "I am happy", "author": "Bot"}`)
+	post("/text", `{"textString": "I am happy but sad"}`)
+	mockPipeline.Stop(context.Background())
+	// The text of the bot is counted, but weighs 0, and the other text weighs 1, split across its categories.
+	sents, _ := mockDB.FetchSentiments("")
+	expected := map[database.Category]database.Sentiment{
+		"jovility": database.Sentiment{Value: 0.5, TextCount: 2, WeightedCount: 0.5},
+		"sadness":  database.Sentiment{Value: 0.5, TextCount: 1, WeightedCount: 0.5},
+	}
+	if !reflect.DeepEqual(sents, expected) {
+		t.Errorf("Failed: expected sentiments %v, recieved %v", expected, sents)
+	}
+	if body := post("/analyze", `{"textString": "I am happy", "author": "bot"}`).Body.String(); !strings.Contains(body, `"Weights":{"jovility":0}`) {
+		t.Errorf("POST /analyze returned unexpected weights: %v", body)
+	}
+
+	invalid := mockHandler.settings().cf
+	invalid.AuthorWeights = map[string]float64{"bot": -1}
+	if _, err := mockHandler.Reload(invalid); err == nil {
+		t.Errorf("Failed: expected an error for a negative author weight")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	clf, err := getClassifier(mockConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, clf, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, clf)
+	type testCase struct {
+		body     string
+		status   int
+		expected string
+	}
+	cases := []testCase{
+		testCase{body: `{"textString": "I am very happy"}`, status: http.StatusOK,
+			expected: `{"Valid":true,"Lang":"en","Tokens":["i","am","very","happy"],"SelfRefs":["i","am"],` +
+				`"States":[{"State":"happy","Source":"built-in","Categories":["jovility"],"Modifiers":["very"],` +
+				`"Matches":[{"Category":"jovility","Weight":1.5}]}],"Categories":["jovility"],"Weights":{"jovility":1.5},"Reasons":[]}`},
+		testCase{body: `{"textString": "It is a joyful day"}`, status: http.StatusOK,
+			expected: `{"Valid":false,"Lang":"en","Tokens":["it","is","a","joyful","day"],"SelfRefs":[],` +
+				`"States":[{"State":"joyful","Source":"built-in","Categories":["jovility"],"Modifiers":[],` +
+				`"Matches":[{"Category":"jovility","Weight":1}]}],"Categories":["jovility"],"Weights":{"jovility":1},` +
+				`"Reasons":["The text holds no self reference in en"]}`},
+		testCase{body: `{"textString": "No estoy triste"}`, status: http.StatusOK,
+			expected: `{"Valid":true,"Lang":"es","Tokens":["no","estoy","triste"],"SelfRefs":["estoy"],` +
+				`"States":[{"State":"triste","Source":"built-in","Categories":["sadness"],"Modifiers":["no"],"Matches":[]}],` +
+				`"Categories":[],"Weights":{},` +
+				`"Reasons":["The text is assigned no category, e.g. its sentiment states are negated, so it would not be stored"]}`},
+		testCase{body: `{"textString": ""}`, status: http.StatusBadRequest, expected: `"TextString is empty"`},
+		testCase{body: `{"textString": "I am happy", "community": "#mon day"}`, status: http.StatusBadRequest,
+			expected: `"Community \"#mon day\" is not valid, it must be made of at most 64 letters, digits, '-', '_' or '#'"`},
+		testCase{body: `{"textString": "Je suis content", "lang": "fr"}`, status: http.StatusBadRequest,
+			expected: `"Lang \"fr\" is not one of the configured languages [en es pt]"`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("POST", "/analyze", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		if respRec.Code != c.status || respRec.Body.String() != c.expected {
+			t.Errorf("POST /analyze returned unexpected response for %v: got %v %v, expected %v", c.body, respRec.Code, respRec.Body.String(), c.expected)
+		}
+	}
+	if stats := mockPipeline.Stats(); stats.Submitted != 0 {
+		t.Errorf("POST /analyze published to the pipeline: %+v", stats)
+	}
+}
+
+func TestStreamSentiments(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	srv := httptest.NewServer(Routes(mockHandler))
+	defer srv.Close()
+	defer mockHandler.broker.Close()
+	epoch := mockHandler.broker.Epoch()
+	// readEvent reads the lines of the next event, or of the next comment.
+	readEvent := func(r *bufio.Reader) []string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return lines
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/sentiments/stream?community=%23friday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /sentiments/stream returned unexpected response: %v %v", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	mockDB.UpdateSentiment(database.SentimentUpdate{Community: "#friday", Category: "jovility", Count: 1, At: time.Now()})
+	expected := []string{"id: " + epoch + "-2", "event: sentiment",
+		`data: {"Community":"#friday","Category":"jovility","Value":1,"TextCount":1,"WeightedCount":1,"TotalTexts":1,"TotalWeight":1}`}
+	if out := readEvent(bufio.NewReader(resp.Body)); !reflect.DeepEqual(out, expected) {
+		t.Errorf("GET /sentiments/stream returned unexpected event: got %v, expected %v", out, expected)
+	}
+
+	mockDB.UpdateSentiment(database.SentimentUpdate{Community: "#friday", Category: "sadness", Count: 1, At: time.Now()})
+	type testCase struct {
+		url      string
+		lastID   string
+		expected []string
+	}
+	cases := []testCase{
+		testCase{url: "/sentiments/stream", lastID: epoch + "-2", expected: []string{"id: " + epoch + "-3", "event: sentiment",
+			`data: {"Category":"sadness","Value":0.5,"TextCount":1,"WeightedCount":1,"TotalTexts":2,"TotalWeight":2}`}},
+		testCase{url: "/sentiments/stream?community=%23friday", lastID: epoch + "-1", expected: []string{"id: " + epoch + "-2", "event: sentiment",
+			`data: {"Community":"#friday","Category":"jovility","Value":1,"TextCount":1,"WeightedCount":1,"TotalTexts":1,"TotalWeight":1}`}},
+		testCase{url: "/sentiments/stream", lastID: epoch + "-5", expected: []string{"event: reset", "data: {}"}},
+		// The IDs sent before a restart are from another epoch, their events are no longer available.
+		testCase{url: "/sentiments/stream", lastID: "kf3x2a1b-2", expected: []string{"event: reset", "data: {}"}},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", srv.URL+c.url, nil)
+		req.Header.Set("Last-Event-ID", c.lastID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := readEvent(bufio.NewReader(resp.Body)); !reflect.DeepEqual(out, c.expected) {
+			t.Errorf("GET /sentiments/stream after %v returned unexpected event: got %v, expected %v", c.lastID, out, c.expected)
+		}
+		resp.Body.Close()
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/sentiments/stream", nil)
+	req.Header.Set("Last-Event-ID", "last")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /sentiments/stream returned wrong status code: got %v want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestStreamTexts(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10, FeedBuffer: 10,
+		FeedOrigins: []string{"https://moderation.example.com"}}
+	var mockPipeline = pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	mockPipeline.Start()
+	srv := httptest.NewServer(Routes(mockHandler))
+	defer srv.Close()
+	defer mockHandler.feed.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/texts/stream"
+
+	type testCase struct {
+		origin string
+		status int
+	}
+	cases := []testCase{
+		testCase{origin: "", status: http.StatusSwitchingProtocols},
+		testCase{origin: srv.URL, status: http.StatusSwitchingProtocols},
+		testCase{origin: "https://moderation.example.com", status: http.StatusSwitchingProtocols},
+		testCase{origin: "https://evil.example.com", status: http.StatusForbidden},
+		testCase{origin: "null", status: http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", srv.URL+"/texts/stream", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("GET /texts/stream from %q returned wrong status code: got %v want %v", c.origin, resp.StatusCode, c.status)
+		}
+	}
+
+	ws, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	websocket.Message.Send(ws, `{"categories": ["sadness"], "communities": [""]}`)
+	var ack string
+	websocket.Message.Receive(ws, &ack)
+	if expected := `{"Categories":["sadness"],"Communities":["default"]}`; ack != expected {
+		t.Errorf("GET /texts/stream returned unexpected acknowledgement: got %v, expected %v", ack, expected)
+	}
+	for _, txt := range []string{"I am happy", "I am sad"} {
+		jsonReq, _ := json.Marshal(SaveTextReq{TextString: txt})
+		req, _ := http.NewRequest("POST", "/text", bytes.NewBuffer(jsonReq))
+		http.HandlerFunc(mockHandler.SaveText).ServeHTTP(httptest.NewRecorder(), req)
+	}
+	var resp FeedTextResp
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := websocket.JSON.Receive(ws, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TextString != "I am sad" || !reflect.DeepEqual(resp.Categories, []string{"sadness"}) || resp.Community != "default" {
+		t.Errorf("GET /texts/stream returned unexpected text: %v", resp)
+	}
+	if saved, err := mockDB.FetchText(database.ID(resp.ID)); err != nil || saved.TextString != "I am sad" {
+		t.Errorf("GET /texts/stream returned the ID of an unexpected text: %v, %v", saved, err)
+	}
+
+	invalid, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer invalid.Close()
+	websocket.Message.Send(invalid, `{"categories": ["boredom"]}`)
+	var msg string
+	websocket.Message.Receive(invalid, &msg)
+	if expected := `"categories must be sentiment categories, and communities must be valid"`; msg != expected {
+		t.Errorf("GET /texts/stream returned unexpected error: got %v, expected %v", msg, expected)
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 2, PartitionBuffer: 10}
+	var mockPipeline = pipeline.GetMemPipeline(2, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	counts := func() (float64, float64, float64) {
+		return testutil.ToFloat64(textsReceived), testutil.ToFloat64(textsValid), testutil.ToFloat64(textsInvalid)
+	}
+	received, valid, invalid := counts()
+	for _, body := range []string{`{"textString": "I am happy"}`, `{"textString": "It is a happy day"}`, `{"textString": ""}`} {
+		req, _ := http.NewRequest("POST", "/text", strings.NewReader(body))
+		http.HandlerFunc(mockHandler.SaveText).ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if r, v, i := counts(); r-received != 3 || v-valid != 1 || i-invalid != 2 {
+		t.Errorf("SaveText counted unexpected texts: received %v, valid %v, invalid %v", r-received, v-valid, i-invalid)
+	}
+	received, valid, invalid = counts()
+	batch := `[{"textString": "I am happy"}, {"textString": "It is a happy day"}, {"textString": ""}, {"textString": 42}]`
+	req, _ := http.NewRequest("POST", "/texts/batch", strings.NewReader(batch))
+	http.HandlerFunc(mockHandler.SaveTexts).ServeHTTP(httptest.NewRecorder(), req)
+	if r, v, i := counts(); r-received != 4 || v-valid != 1 || i-invalid != 3 {
+		t.Errorf("SaveTexts counted unexpected texts: received %v, valid %v, invalid %v", r-received, v-valid, i-invalid)
+	}
+	mockDB.UpdateSentiment(database.SentimentUpdate{Category: "jovility", Count: 1, At: time.Now()})
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	if respRec.Code != http.StatusOK || !strings.HasPrefix(respRec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("GET /metrics returned unexpected response: %v %v", respRec.Code, respRec.Header().Get("Content-Type"))
+	}
+	body := respRec.Body.String()
+	expected := []string{
+		"# TYPE sentiment_texts_received_total counter\n",
+		"# TYPE sentiment_pipeline_stage_duration_seconds histogram\n",
+		"# TYPE go_goroutines gauge\n",
+		"sentiment_pipeline_partition_length{partition=\"1\",stage=\"validText\"} 1\n",
+		"sentiment_pipeline_partition_capacity{partition=\"1\",stage=\"processedText\"} 10\n",
+		"sentiment_category_value{category=\"jovility\"} 1\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("GET /metrics returned no %q, got:\n%v", e, body)
+		}
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 2, PartitionBuffer: 1, ReadinessSaturation: 0.5}
+	var mockPipeline = pipeline.GetMemPipeline(2, 1, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	readyz := func() (int, ReadinessResp) {
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		respRec := httptest.NewRecorder()
+		Routes(mockHandler).ServeHTTP(respRec, req)
+		var resp ReadinessResp
+		if err := json.Unmarshal(respRec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return respRec.Code, resp
+	}
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	if respRec.Code != http.StatusOK || respRec.Body.String() != `{"Status":"ok"}` {
+		t.Errorf("GET /healthz returned unexpected response: %v %v", respRec.Code, respRec.Body.String())
+	}
+
+	// The workers are not started, the text stays in its partition.
+	mockPipeline.Submit(context.Background(), pipeline.TweetText{TextString: "I am happy"})
+	status, resp := readyz()
+	expected := map[string]CheckResp{
+		"workers":    CheckResp{Detail: "0 of the 2 validText workers are running"},
+		"datastore":  CheckResp{Ready: true, Detail: "The datastore is reachable"},
+		"partitions": CheckResp{Detail: "The validText partition 1 holds 1 of 1 texts, above 50% of its capacity"},
+	}
+	if status != http.StatusServiceUnavailable || resp.Ready || !reflect.DeepEqual(resp.Checks, expected) {
+		t.Errorf("GET /readyz returned unexpected response: %v %v", status, resp)
+	}
+
+	mockPipeline.Start()
+	deadline := time.Now().Add(time.Second)
+	for mockPipeline.Stats().Saved < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status, resp := readyz(); status != http.StatusOK || !resp.Ready {
+		t.Errorf("GET /readyz returned unexpected response: %v %v", status, resp)
+	}
+
+	mockPipeline.Stop(context.Background())
+	status, resp = readyz()
+	if status != http.StatusServiceUnavailable || resp.Checks["workers"].Detail != "The pipeline is stopped" {
+		t.Errorf("GET /readyz returned unexpected response: %v %v", status, resp)
+	}
+}
+
+func TestRequestCorrelation(t *testing.T) {
+	var b bytes.Buffer
+	defer func(l *logging.Logger) { logging.Default = l }(logging.Default)
+	logging.Default = logging.New(&b, logging.DebugLevel)
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 2, PartitionBuffer: 10}
+	var mockPipeline = pipeline.GetMemPipeline(2, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB)
+	var mockHandler = GetHandler(mockDB, mockConfig, mockPipeline, classifier.Panas{})
+	mockPipeline.Start()
+
+	req, _ := http.NewRequest("POST", "/text", strings.NewReader(`{"textString": "I am happy"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "client-req-1")
+	respRec := httptest.NewRecorder()
+	Routes(mockHandler).ServeHTTP(respRec, req)
+	mockPipeline.Stop(context.Background())
+	if id := respRec.Header().Get("X-Request-ID"); id != "client-req-1" {
+		t.Errorf("POST /text returned unexpected request ID: %v", id)
+	}
+	page, _ := mockDB.FetchTexts(database.TextQuery{})
+	if len(page.Texts) != 1 || page.Texts[0].RequestID != "client-req-1" {
+		t.Errorf("POST /text saved unexpected texts: %v", page.Texts)
+	}
+
+	type entry struct {
+		Msg       string
+		RequestID string
+		Stage     string
+		Status    int
+	}
+	var entries []entry
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Failed to decode the log entry %v: %v", line, err)
+		}
+		if e.RequestID == "client-req-1" {
+			entries = append(entries, e)
+		}
+	}
+	expected := []entry{
+		entry{Msg: "Text admitted", RequestID: "client-req-1", Stage: "publish"},
+		entry{Msg: "Request served", RequestID: "client-req-1", Status: http.StatusOK},
+		entry{Msg: "Text categorized", RequestID: "client-req-1", Stage: "process"},
+		entry{Msg: "Text saved", RequestID: "client-req-1", Stage: "save"},
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Msg < entries[j].Msg })
+	sort.Slice(expected, func(i, j int) bool { return expected[i].Msg < expected[j].Msg })
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected log entries of the request: %v, expected %v", entries, expected)
+	}
+
+	if _, err := mockHandler.Reload(config.Config{LogLevel: "verbose"}); err == nil {
+		t.Errorf("Reload accepted an unknown log level")
+	}
+}
+
+func TestQuietRequests(t *testing.T) {
+	var b bytes.Buffer
+	defer func(l *logging.Logger) { logging.Default = l }(logging.Default)
+	logging.Default = logging.New(&b, logging.InfoLevel)
+	var mockDB = database.GetDatastore()
+	var mockConfig = config.Config{Port: ":3000", Partitions: 4, PartitionBuffer: 10}
+	var mockHandler = GetHandler(mockDB, mockConfig, pipeline.GetMemPipeline(4, 10, pipeline.Admission{}, classifier.Panas{}, pipeline.Weighting{}, mockDB), classifier.Panas{})
+	type testCase struct {
+		path   string
+		logged bool
+	}
+	cases := []testCase{
+		testCase{path: "/healthz", logged: false},
+		testCase{path: "/readyz", logged: false},
+		testCase{path: "/metrics", logged: false},
+		testCase{path: "/sentiments", logged: true},
+	}
+	for _, c := range cases {
+		b.Reset()
+		req, _ := http.NewRequest("GET", c.path, nil)
+		Routes(mockHandler).ServeHTTP(httptest.NewRecorder(), req)
+		if logged := strings.Contains(b.String(), `"msg":"Request served"`); logged != c.logged {
+			t.Errorf("GET %v was logged at the info level: %v, expected %v", c.path, logged, c.logged)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultReadinessSaturation applies to a configuration without a ReadinessSaturation.
+	defaultReadinessSaturation = 0.9
+	// pingTimeout is the time the datastore has to answer a readiness check.
+	pingTimeout = 2 * time.Second
+)
+
+// HealthResp is used for creating a response object for Healthz handler.
+type HealthResp struct {
+	Status string
+}
+
+// CheckResp is the result of a readiness check.
+type CheckResp struct {
+	Ready  bool
+	Detail string
+}
+
+// ReadinessResp is used for creating a response object for Readyz handler.
+type ReadinessResp struct {
+	Ready  bool
+	Checks map[string]CheckResp
+}
+
+// Healthz is an http handler that reports that the service is alive, as long as it serves the requests.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	utils.JSONSuccessResponse(w, HealthResp{Status: "ok"})
+}
+
+// Readyz is an http handler that reports whether the service is ready to accept texts, along with the result
+// of every check: the workers of the pipeline are running ("workers"), the datastore is reachable ("datastore"),
+// and no partition of the pipeline is filled above the ReadinessSaturation ("partitions").
+// It responds with 503 Service Unavailable if any of the checks fails.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResp{Ready: true, Checks: map[string]CheckResp{
+		"workers":    h.checkWorkers(),
+		"datastore":  h.checkDatastore(),
+		"partitions": h.checkPartitions(),
+	}}
+	for _, c := range resp.Checks {
+		resp.Ready = resp.Ready && c.Ready
+	}
+	if !resp.Ready {
+		utils.JSONUnavailableDataResponse(w, resp)
+		return
+	}
+	utils.JSONSuccessResponse(w, resp)
+}
+
+// checkWorkers checks that the pipeline accepts texts, and that every partition is consumed by a running worker.
+func (h *Handler) checkWorkers() CheckResp {
+	stats := h.pl.Stats()
+	if stats.Stopped {
+		return CheckResp{Detail: "The pipeline is stopped"}
+	}
+	detail := ""
+	for i, stage := range stats.Stages {
+		if stage.Workers < len(stage.Partitions) {
+			return CheckResp{Detail: fmt.Sprintf("%v of the %v %v workers are running", stage.Workers,
+				len(stage.Partitions), stage.Name)}
+		}
+		if i > 0 {
+			detail += ", "
+		}
+		detail += fmt.Sprintf("%v %v workers are running", stage.Workers, stage.Name)
+	}
+	return CheckResp{Ready: true, Detail: detail}
+}
+
+// checkDatastore checks that the datastore answers a ping within the pingTimeout. A datastore that is not a Pinger
+// is pinged by fetching its communities.
+func (h *Handler) checkDatastore() CheckResp {
+	ping := func() error {
+		_, err := h.db.FetchCommunities()
+		return err
+	}
+	if p, ok := h.db.(database.Pinger); ok {
+		ping = p.Ping
+	}
+	done := make(chan error, 1)
+	go func() { done <- ping() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return CheckResp{Detail: fmt.Sprintf("The datastore is not reachable: %v", err)}
+		}
+		return CheckResp{Ready: true, Detail: "The datastore is reachable"}
+	case <-time.After(pingTimeout):
+		return CheckResp{Detail: fmt.Sprintf("The datastore did not answer within %v", pingTimeout)}
+	}
+}
+
+// checkPartitions checks that no partition of the pipeline is filled above the ReadinessSaturation.
+func (h *Handler) checkPartitions() CheckResp {
+	saturation := h.settings().cf.ReadinessSaturation
+	if saturation <= 0 {
+		saturation = defaultReadinessSaturation
+	}
+	for _, stage := range h.pl.Stats().Stages {
+		for i, p := range stage.Partitions {
+			if float64(p.Len) > saturation*float64(p.Cap) {
+				return CheckResp{Detail: fmt.Sprintf("The %v partition %v holds %v of %v texts, above %.0f%% of its capacity",
+					stage.Name, i, p.Len, p.Cap, saturation*100)}
+			}
+		}
+	}
+	return CheckResp{Ready: true, Detail: fmt.Sprintf("The partitions are filled up to %.0f%% of their capacity", saturation*100)}
+}
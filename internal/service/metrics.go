@@ -0,0 +1,87 @@
+package service
+
+import (
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+)
+
+var (
+	textsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sentiment_texts_received_total",
+		Help: "Number of the texts received by POST /text and POST /texts/batch.",
+	})
+	textsValid = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sentiment_texts_valid_total",
+		Help: "Number of the texts received by POST /text and POST /texts/batch that are valid as per the classifier.",
+	})
+	textsInvalid = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sentiment_texts_invalid_total",
+		Help: "Number of the texts received by POST /text and POST /texts/batch that are not valid as per the classifier, or whose body is invalid.",
+	})
+)
+
+var (
+	partitionLengthDesc = prometheus.NewDesc("sentiment_pipeline_partition_length",
+		"Number of the texts in a partition of the pipeline.", []string{"stage", "partition"}, nil)
+	partitionCapacityDesc = prometheus.NewDesc("sentiment_pipeline_partition_capacity",
+		"Capacity of a partition of the pipeline.", []string{"stage", "partition"}, nil)
+	categoryValueDesc = prometheus.NewDesc("sentiment_category_value",
+		"Sentiment value of a category, across all the communities.", []string{"category"}, nil)
+)
+
+// stateCollector is a prometheus.Collector of the metrics that are read from the db and the pipeline when they are
+// collected: the length and the capacity of every partition, and the value of every category across all
+// the communities.
+type stateCollector struct {
+	db database.DataStore
+	pl pipeline.Pipeline
+}
+
+// Describe is exposed by prometheus.Collector interface. stateCollector implements this method.
+func (c stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- partitionLengthDesc
+	ch <- partitionCapacityDesc
+	ch <- categoryValueDesc
+}
+
+// Collect is exposed by prometheus.Collector interface. stateCollector implements this method.
+func (c stateCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stage := range c.pl.Stats().Stages {
+		for i, p := range stage.Partitions {
+			partition := strconv.Itoa(i)
+			ch <- prometheus.MustNewConstMetric(partitionLengthDesc, prometheus.GaugeValue, float64(p.Len),
+				stage.Name, partition)
+			ch <- prometheus.MustNewConstMetric(partitionCapacityDesc, prometheus.GaugeValue, float64(p.Cap),
+				stage.Name, partition)
+		}
+	}
+	sents, err := c.db.FetchSentiments("")
+	if err != nil {
+		logging.Error("Error while fetching the sentiments of the metrics", logging.Fields{"error": err})
+		return
+	}
+	for catg, sent := range sents {
+		ch <- prometheus.MustNewConstMetric(categoryValueDesc, prometheus.GaugeValue, sent.Value, string(catg))
+	}
+}
+
+// newMetrics returns an http handler that exposes the metrics of the default registry, i.e. the counters and
+// the histograms of the service along with the metrics of the Go runtime and of the process, and the metrics
+// that are read from the db and the pipeline. The latter are kept in a registry of their own, so that every
+// Handler exposes its own db and pipeline.
+func newMetrics(db database.DataStore, pl pipeline.Pipeline) http.Handler {
+	r := prometheus.NewRegistry()
+	r.MustRegister(stateCollector{db: db, pl: pl})
+	return promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, r}, promhttp.HandlerOpts{})
+}
+
+// GetMetrics is an http handler that exposes the metrics of the service in the Prometheus text exposition format.
+func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	h.metrics.ServeHTTP(w, r)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"crypto/subtle"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"github.com/go-chi/chi/middleware"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestIDHeader is the header that carries the ID of a request, in both the request and the response.
+// A request ID supplied by the client is kept, see middleware.RequestID.
+const requestIDHeader = "X-Request-ID"
+
+// quietPaths are the paths of the requests that are polled, by the probes and by Prometheus. They are logged
+// at the debug level, so that they don't drown the other requests.
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// logRequests is a middleware that returns the ID of every request in the requestIDHeader, and logs the request
+// once it is served, along with its ID. The texts carried by the request are logged with the same ID by the stages
+// of the pipeline. The quietPaths are logged at the debug level. It must follow middleware.RequestID.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := middleware.GetReqID(r.Context())
+		w.Header().Set(requestIDHeader, reqID)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		fields := logging.Fields{"requestID": reqID, "method": r.Method, "path": r.URL.Path,
+			"durationMs": float64(time.Since(start).Microseconds()) / 1000, "bytes": ww.BytesWritten()}
+		// The status of a hijacked connection, e.g. a WebSocket, is unknown.
+		if status := ww.Status(); status != 0 {
+			fields["status"] = status
+		}
+		level := logging.InfoLevel
+		if quietPaths[r.URL.Path] {
+			level = logging.DebugLevel
+		}
+		logging.Log(level, "Request served", fields)
+	})
+}
+
+// requireAdminToken is a middleware that restricts the admin endpoints to the requests that carry the configured
+// AdminToken as a bearer token. The admin endpoints are disabled if no AdminToken is configured.
+func (h *Handler) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := h.settings().cf.AdminToken
+		if token == "" {
+			utils.JSONForbiddenResponse(w, "The admin endpoints are disabled, no adminToken is configured")
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			utils.JSONUnauthorizedResponse(w, "Invalid or missing admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
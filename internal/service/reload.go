@@ -0,0 +1,227 @@
+package service
+
+import (
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/config"
+	"github.com/coderafting/sentiment-analysis/internal/classifier"
+	"github.com/coderafting/sentiment-analysis/internal/language"
+	"github.com/coderafting/sentiment-analysis/internal/logging"
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"github.com/go-chi/chi/middleware"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// reloadableSettings are the Config fields that are applied by a reload. A change to any other field
+// requires a restart of the service.
+var reloadableSettings = []string{
+	"AdmissionPolicy", "AdmissionTimeout", "RetryAfter", "BatchMaxItems", "DefaultBucket", "Classifier", "Lexicons", "Modifiers",
+	"Languages", "LanguageLexicons", "StreamInterval", "FeedBuffer", "FeedOrigins", "ReadinessSaturation", "LogLevel", "SplitCategories",
+	"AuthorWeights",
+}
+
+// runtimeSettings are the settings of a Handler that are replaced by a reload.
+type runtimeSettings struct {
+	cf        config.Config
+	clf       classifier.Classifier
+	det       language.Detector
+	weighting pipeline.Weighting
+}
+
+// ReloadResp is used for creating a response object for Reload handler.
+// Reloaded lists the settings that were changed by the reload, and RestartRequired lists the settings
+// that were changed in the configuration, but are not applied until the service is restarted.
+type ReloadResp struct {
+	Reloaded        []string
+	RestartRequired []string
+}
+
+// settings returns the current runtime settings of the Handler.
+func (h *Handler) settings() runtimeSettings {
+	return h.rt.Load().(runtimeSettings)
+}
+
+// getModifiers instantiates the configured negators and boosters of a language. The settings that are not configured
+// take the default values of the classifier, and the negated states are suppressed by default. The configured
+// negators and boosters apply to English, the other languages use their built-in ones.
+func getModifiers(mc config.ModifiersConfig, lang string) (classifier.Modifiers, error) {
+	negation, negators, boosters := classifier.NegationMode(mc.Negation), mc.Negators, mc.Boosters
+	scope, negatedWeight := mc.Scope, mc.NegatedWeight
+	if negation == "" {
+		negation = classifier.Suppress
+	}
+	if negators == nil || lang != language.English {
+		negators = classifier.LanguageNegators[lang]
+	}
+	if boosters == nil || lang != language.English {
+		boosters = classifier.LanguageBoosters[lang]
+	}
+	if scope == 0 {
+		scope = classifier.DefaultScope
+	}
+	if negatedWeight == 0 {
+		negatedWeight = classifier.DefaultNegatedWeight
+	}
+	return classifier.NewModifiers(negation, negators, boosters, scope, negatedWeight)
+}
+
+// getDetector returns the detector of the configured languages, or of all the supported languages if none is configured.
+func getDetector(cf config.Config) (language.Detector, error) {
+	return language.NewDetector(cf.Languages...)
+}
+
+// getClassifier instantiates the classifier selected in the configuration, for every configured language,
+// with the configured lexicons and modifiers. The conflicts between the lexicons are logged.
+// The texts of an unknown language are handled by the classifier of the first language.
+func getClassifier(cf config.Config) (classifier.Classifier, error) {
+	det, err := getDetector(cf)
+	if err != nil {
+		return nil, err
+	}
+	langs := det.Languages()
+	for lang := range cf.LanguageLexicons {
+		if lang == language.English {
+			return nil, fmt.Errorf("The English lexicons are configured as lexicons, rather than languageLexicons")
+		}
+		if !language.IsSupported(lang) {
+			return nil, fmt.Errorf("Language %q of the languageLexicons is not one of %v: %w", lang, language.Supported(),
+				language.ErrUnsupportedLanguage)
+		}
+	}
+	clf := classifier.Multilingual{Default: langs[0], Classifiers: map[string]classifier.Classifier{}}
+	for _, lang := range langs {
+		paths := cf.LanguageLexicons[lang]
+		if lang == language.English {
+			paths = cf.Lexicons
+		}
+		lex, conflicts, err := classifier.LoadLanguageLexicon(lang, paths...)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range conflicts {
+			logging.Warn("Lexicon conflict", logging.Fields{"lang": lang, "conflict": c.String()})
+		}
+		if len(paths) > 0 {
+			logging.Info("Lexicons loaded", logging.Fields{"lang": lang, "states": lex.Len(), "lexicons": paths})
+		}
+		mods, err := getModifiers(cf.Modifiers, lang)
+		if err != nil {
+			return nil, err
+		}
+		opts := classifier.Options{Lexicon: lex, Modifiers: mods, Lang: lang}
+		if clf.Classifiers[lang], err = classifier.GetClassifier(cf.Classifier, opts); err != nil {
+			return nil, err
+		}
+	}
+	return clf, nil
+}
+
+// getAdmission returns the pipeline admission configuration.
+func getAdmission(cf config.Config) (pipeline.Admission, error) {
+	adm := pipeline.Admission{Policy: pipeline.AdmissionPolicy(cf.AdmissionPolicy), Timeout: cf.AdmissionTimeout}
+	if adm.Policy != "" && !pipeline.ValidAdmissionPolicy(adm.Policy) {
+		return adm, fmt.Errorf("Unknown admission policy: %v", cf.AdmissionPolicy)
+	}
+	return adm, nil
+}
+
+// getWeighting returns the configured weighting of the categories of the texts. The weights of the authors
+// must not be negative.
+func getWeighting(cf config.Config) (pipeline.Weighting, error) {
+	w := pipeline.Weighting{Split: cf.SplitCategories, Authors: map[string]float64{}}
+	for author, f := range cf.AuthorWeights {
+		if f < 0 {
+			return w, fmt.Errorf("The weight of the author %q must not be negative, got %v", author, f)
+		}
+		w.Authors[strings.ToLower(author)] = f
+	}
+	return w, nil
+}
+
+// getLogLevel returns the configured log level, the InfoLevel if none is configured.
+func getLogLevel(cf config.Config) (logging.Level, error) {
+	if cf.LogLevel == "" {
+		return logging.InfoLevel, nil
+	}
+	return logging.ParseLevel(cf.LogLevel)
+}
+
+// Reload applies the reloadable settings of the supplied configuration: the classifier and its lexicons are rebuilt,
+// and swapped atomically in the Handler and in the pipeline, along with the admission and the other settings.
+// The workers of the pipeline keep running. If the configuration is invalid, the current settings are kept.
+func (h *Handler) Reload(cf config.Config) (ReloadResp, error) {
+	h.reloadMux.Lock()
+	defer h.reloadMux.Unlock()
+	return h.reload(cf)
+}
+
+// reloadConfigFile reads the configuration with loadConfig, and applies it the way Reload does. The configuration
+// is read and applied within the same critical section, so that a configuration read earlier never replaces
+// one read later.
+func (h *Handler) reloadConfigFile() (ReloadResp, error) {
+	h.reloadMux.Lock()
+	defer h.reloadMux.Unlock()
+	cf, err := h.loadConfig()
+	if err != nil {
+		return ReloadResp{}, err
+	}
+	return h.reload(cf)
+}
+
+// reload applies the reloadable settings of the configuration, the caller must hold the reloadMux.
+func (h *Handler) reload(cf config.Config) (ReloadResp, error) {
+	resp := ReloadResp{Reloaded: []string{}, RestartRequired: []string{}}
+	adm, err := getAdmission(cf)
+	if err != nil {
+		return resp, err
+	}
+	clf, err := getClassifier(cf)
+	if err != nil {
+		return resp, err
+	}
+	det, err := getDetector(cf)
+	if err != nil {
+		return resp, err
+	}
+	level, err := getLogLevel(cf)
+	if err != nil {
+		return resp, err
+	}
+	weighting, err := getWeighting(cf)
+	if err != nil {
+		return resp, err
+	}
+	current := h.settings().cf
+	reloaded := current
+	oldVal, newVal, val := reflect.ValueOf(current), reflect.ValueOf(cf), reflect.ValueOf(&reloaded).Elem()
+	for _, name := range reloadableSettings {
+		if !reflect.DeepEqual(oldVal.FieldByName(name).Interface(), newVal.FieldByName(name).Interface()) {
+			resp.Reloaded = append(resp.Reloaded, name)
+		}
+		val.FieldByName(name).Set(newVal.FieldByName(name))
+	}
+	for i := 0; i < newVal.NumField(); i++ {
+		if !reflect.DeepEqual(val.Field(i).Interface(), newVal.Field(i).Interface()) {
+			resp.RestartRequired = append(resp.RestartRequired, newVal.Type().Field(i).Name)
+		}
+	}
+	h.pl.Reconfigure(adm, clf, weighting)
+	h.rt.Store(runtimeSettings{cf: reloaded, clf: clf, det: det, weighting: weighting})
+	logging.SetLevel(level)
+	return resp, nil
+}
+
+// ReloadConfig is an http handler that re-reads the configuration file, and reloads the settings of the service.
+// It responds with 500 if the configuration can not be read or is invalid, in which case the current settings are kept.
+func (h *Handler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	data, err := h.reloadConfigFile()
+	if err != nil {
+		utils.JSONInternalErrorResponse(w, err.Error())
+		return
+	}
+	logging.Info("Configuration reloaded", logging.Fields{"requestID": middleware.GetReqID(r.Context()),
+		"reloaded": data.Reloaded, "restartRequired": data.RestartRequired})
+	utils.JSONSuccessResponse(w, data)
+}
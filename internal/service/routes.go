@@ -7,16 +7,42 @@ import (
 
 // Routes specifies and returns the available http routes that are exposed as REST APIs.
 // The allowed content type is JSON for all APIs.
-// Authentication has been ignored for this demo service.
+// Authentication has been ignored for this demo service, except for the admin endpoints, which require
+// the configured admin token.
 // A JWT based authentication can be implemented using the following packages:
 // 		- github.com/dgrijalva/jwt-go
 //		- github.com/go-chi/jwtauth
 func Routes(h *Handler) *chi.Mux {
 	r := chi.NewRouter()
+	// Every request gets an ID, which is stored along with the texts that the request carried,
+	// and which correlates the log entries of the request and of its texts.
+	r.Use(middleware.RequestID)
+	r.Use(logRequests)
+	// The endpoints for the monitoring and the orchestration of the service.
+	// The metrics are exposed in the Prometheus text exposition format, rather than JSON.
+	r.Get("/metrics", h.GetMetrics)
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.AllowContentType("application/json"))
 		r.Post("/text", h.SaveText)
+		r.Post("/analyze", h.Analyze)
 		r.Get("/sentiments", h.GetSentiments)
+		r.Get("/sentiments/timeseries", h.GetTimeSeries)
+		r.Get("/sentiments/stream", h.StreamSentiments)
+		r.Get("/sentiments/compare", h.CompareSentiments)
+		r.Get("/sentiments/{category}", h.GetCategorySentiments)
+		r.Get("/communities", h.GetCommunities)
+		r.With(h.requireAdminToken).Post("/admin/reload", h.ReloadConfig)
+		r.Get("/baseline", h.GetBaseline)
+		r.Post("/baseline", h.FreezeBaseline)
+		r.Get("/texts", h.GetTexts)
+		r.Get("/texts/stream", h.StreamTexts)
+		r.Get("/texts/{id}", h.GetText)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AllowContentType("application/json", "application/x-ndjson"))
+		r.Post("/texts/batch", h.SaveTexts)
 	})
 	return r
 }
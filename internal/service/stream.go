@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/coderafting/sentiment-analysis/internal/stream"
+	"github.com/coderafting/sentiment-analysis/internal/utils"
+	"net/http"
+	"time"
+)
+
+const (
+	// streamHistorySize is the number of the last sentiment events that are kept for the resumptions of the stream.
+	streamHistorySize = 1000
+	// streamHeartbeat is the interval of the comments that keep an idle stream open through the proxies.
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamSentiments is an http handler that pushes the sentiment changes as Server-Sent Events. Every event carries
+// the category that changed, along with its Value, TextCount, WeightedCount and the TotalTexts. The changes are
+// pushed as they happen, or coalesced per category at the StreamInterval configuration.
+// The community query param, if supplied, selects the changes within a single community.
+// A client that reconnects with the Last-Event-ID header receives the latest change of every category that changed
+// since, or a reset event if those changes are no longer available, e.g. because the event IDs are from before
+// a restart, in which case it should fetch the sentiments again.
+func (h *Handler) StreamSentiments(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.JSONInternalErrorResponse(w, "Streaming is not supported")
+		return
+	}
+	comm := r.URL.Query().Get("community")
+	if !isValidCommunity(comm) {
+		utils.JSONErrorResponse(w, "community is not valid")
+		return
+	}
+	sub, err := h.broker.Subscribe(comm, r.Header.Get("Last-Event-ID"))
+	if err == stream.ErrInvalidEventID {
+		utils.JSONErrorResponse(w, "Last-Event-ID must be the ID of an event")
+		return
+	}
+	defer sub.Cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err == stream.ErrGap {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	flusher.Flush()
+	var tick <-chan time.Time
+	if interval := h.settings().cf.StreamInterval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case <-sub.Ready():
+			if tick == nil {
+				writeEvents(w, sub.Next())
+				flusher.Flush()
+			}
+		case <-tick:
+			writeEvents(w, sub.Next())
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvents writes the events in the Server-Sent Events format.
+func writeEvents(w http.ResponseWriter, events []stream.Event) {
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "id: %v\nevent: sentiment\ndata: %s\n\n", e.StreamID(), data)
+	}
+}
@@ -0,0 +1,76 @@
+// Package stats provides the statistics used to compare the sentiments of two groups of texts,
+// e.g. two communities, or two time windows.
+package stats
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrEmptySample is returned when a sample holds no texts.
+var ErrEmptySample = errors.New("empty sample")
+
+// ErrInvalidConfidence is returned when a confidence level is not between 0 and 1.
+var ErrInvalidConfidence = errors.New("invalid confidence level")
+
+// Proportion represents x successes out of n trials, e.g. the texts of a category out of all the texts.
+type Proportion struct {
+	X int
+	N int
+}
+
+// Share returns x/n, or 0 if n is 0.
+func (p Proportion) Share() float64 {
+	if p.N == 0 {
+		return 0
+	}
+	return float64(p.X) / float64(p.N)
+}
+
+// Comparison is the outcome of a comparison of two proportions.
+type Comparison struct {
+	// Difference is the share of the first proportion minus the share of the second one.
+	Difference float64
+	// Lower and Upper are the bounds of the confidence interval of the Difference.
+	Lower float64
+	Upper float64
+	// Z is the statistic of the two-proportion z-test, and PValue is its two-sided p-value.
+	Z      float64
+	PValue float64
+}
+
+// Significant checks if the difference is significant at the supplied confidence level.
+func (c Comparison) Significant(confidence float64) bool {
+	return c.PValue < 1-confidence
+}
+
+// CriticalValue returns the two-sided critical value of the standard normal distribution for the confidence level,
+// e.g. 1.96 for 0.95.
+func CriticalValue(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// CompareProportions compares the proportions a and b. The confidence interval of the difference uses the
+// unpooled standard error, and the z-test uses the pooled standard error, under the null hypothesis
+// that both proportions are equal.
+func CompareProportions(a Proportion, b Proportion, confidence float64) (Comparison, error) {
+	if a.N <= 0 || b.N <= 0 {
+		return Comparison{}, ErrEmptySample
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return Comparison{}, ErrInvalidConfidence
+	}
+	pa, pb := a.Share(), b.Share()
+	na, nb := float64(a.N), float64(b.N)
+	c := Comparison{Difference: pa - pb, PValue: 1}
+	se := math.Sqrt(pa*(1-pa)/na + pb*(1-pb)/nb)
+	margin := CriticalValue(confidence) * se
+	c.Lower, c.Upper = c.Difference-margin, c.Difference+margin
+	pooled := float64(a.X+b.X) / (na + nb)
+	pooledSE := math.Sqrt(pooled * (1 - pooled) * (1/na + 1/nb))
+	if pooledSE > 0 {
+		c.Z = c.Difference / pooledSE
+		c.PValue = math.Erfc(math.Abs(c.Z) / math.Sqrt2)
+	}
+	return c, nil
+}
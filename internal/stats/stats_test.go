@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
+
+func TestCriticalValue(t *testing.T) {
+	cases := map[float64]float64{0.9: 1.645, 0.95: 1.960, 0.99: 2.576}
+	for conf, expected := range cases {
+		if out := CriticalValue(conf); !near(out, expected) {
+			t.Errorf("Failed for %v, expected %v, got %v", conf, expected, out)
+		}
+	}
+}
+
+func TestCompareProportions(t *testing.T) {
+	type testCase struct {
+		a           Proportion
+		b           Proportion
+		expected    Comparison
+		significant bool
+	}
+	cases := []testCase{
+		// 30/100 vs 20/100: pooled 0.25, z = 0.1/sqrt(0.25*0.75*0.02) = 1.633, p = 0.102
+		testCase{
+			a:        Proportion{X: 30, N: 100},
+			b:        Proportion{X: 20, N: 100},
+			expected: Comparison{Difference: 0.1, Lower: -0.0192, Upper: 0.2192, Z: 1.633, PValue: 0.1025},
+		},
+		// 300/1000 vs 200/1000: z = 5.164
+		testCase{
+			a:           Proportion{X: 300, N: 1000},
+			b:           Proportion{X: 200, N: 1000},
+			expected:    Comparison{Difference: 0.1, Lower: 0.0623, Upper: 0.1377, Z: 5.164, PValue: 0},
+			significant: true,
+		},
+		// Identical shares, without any variance.
+		testCase{
+			a:        Proportion{X: 10, N: 10},
+			b:        Proportion{X: 5, N: 5},
+			expected: Comparison{PValue: 1},
+		},
+	}
+	for _, c := range cases {
+		out, err := CompareProportions(c.a, c.b, 0.95)
+		if err != nil {
+			t.Fatalf("Failed for %v and %v: %v", c.a, c.b, err)
+		}
+		if !near(out.Difference, c.expected.Difference) || !near(out.Lower, c.expected.Lower) ||
+			!near(out.Upper, c.expected.Upper) || !near(out.Z, c.expected.Z) || !near(out.PValue, c.expected.PValue) {
+			t.Errorf("Failed for %v and %v, expected %+v, got %+v", c.a, c.b, c.expected, out)
+		}
+		if out.Significant(0.95) != c.significant {
+			t.Errorf("Failed for %v and %v, expected significant %v, got %+v", c.a, c.b, c.significant, out)
+		}
+	}
+	if _, err := CompareProportions(Proportion{}, Proportion{X: 1, N: 2}, 0.95); err != ErrEmptySample {
+		t.Errorf("Failed, expected %v, got %v", ErrEmptySample, err)
+	}
+	if _, err := CompareProportions(Proportion{X: 1, N: 2}, Proportion{X: 1, N: 2}, 1); err != ErrInvalidConfidence {
+		t.Errorf("Failed, expected %v, got %v", ErrInvalidConfidence, err)
+	}
+}
@@ -0,0 +1,156 @@
+package stream
+
+/*
+feed offers the live feed of the texts saved by the pipeline. Unlike the sentiment events, the texts can't be
+coalesced: a subscriber that doesn't keep up misses the texts that don't fit in its buffer, and is told how many.
+*/
+
+import (
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Text is a text saved by the pipeline, along with its sentiment categories.
+type Text struct {
+	ID         string
+	TextString string
+	Categories []string
+	Weights    map[string]float64
+	Community  string
+	Lang       string
+	ReceivedAt time.Time
+}
+
+// Filter selects the texts of a feed subscription. A text is selected if it has at least one of the Categories,
+// and if it belongs to one of the Communities. An empty list selects all the texts.
+type Filter struct {
+	Categories  []string
+	Communities []string
+}
+
+// matches checks if the text is selected by the filter.
+func (f Filter) matches(t Text) bool {
+	return (len(f.Communities) == 0 || contains(f.Communities, t.Community)) &&
+		(len(f.Categories) == 0 || containsAny(f.Categories, t.Categories))
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, ss []string) bool {
+	for _, s := range ss {
+		if contains(list, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Feed broadcasts the texts to the feed subscriptions. A Feed never blocks its publisher: a text that doesn't fit
+// in the buffer of a subscription is dropped for that subscription.
+type Feed struct {
+	mux    sync.RWMutex
+	subs   map[*FeedSubscription]bool
+	closed bool
+}
+
+// NewFeed returns a Feed without subscriptions.
+func NewFeed() *Feed {
+	return &Feed{subs: map[*FeedSubscription]bool{}}
+}
+
+// Publish broadcasts a TweetText saved by the pipeline to the subscriptions that select it.
+// A TweetText of the default community is published in the database.DefaultCommunity.
+func (f *Feed) Publish(pt pipeline.TweetText) {
+	t := Text{ID: pt.ID, TextString: pt.TextString, Categories: pt.Categories, Weights: pt.Weights,
+		Community: pt.Community, Lang: pt.Lang, ReceivedAt: pt.ReceivedAt}
+	if t.Community == "" {
+		t.Community = string(database.DefaultCommunity)
+	}
+	if t.Lang == "" {
+		t.Lang = database.DefaultLang
+	}
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	for sub := range f.subs {
+		if !sub.filter.matches(t) {
+			continue
+		}
+		select {
+		case sub.texts <- t:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe registers a subscription to the texts selected by the filter, that buffers up to buffer texts.
+func (f *Feed) Subscribe(filter Filter, buffer int) *FeedSubscription {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	sub := &FeedSubscription{filter: filter, texts: make(chan Text, buffer), done: make(chan struct{}), f: f}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		close(sub.done)
+		return sub
+	}
+	f.subs[sub] = true
+	return sub
+}
+
+// Close closes all the subscriptions, and the subscriptions registered afterwards.
+func (f *Feed) Close() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.closed = true
+	for sub := range f.subs {
+		close(sub.done)
+		delete(f.subs, sub)
+	}
+}
+
+// FeedSubscription holds the texts buffered for a subscriber.
+type FeedSubscription struct {
+	// dropped is accessed atomically, keep it 64-bit aligned at the top of the struct
+	dropped int64
+	filter  Filter
+	texts   chan Text
+	done    chan struct{}
+	f       *Feed
+}
+
+// Texts returns the channel of the buffered texts.
+func (s *FeedSubscription) Texts() <-chan Text {
+	return s.texts
+}
+
+// Done returns a channel that is closed when the FeedSubscription is cancelled, or when the Feed is closed.
+func (s *FeedSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped returns the number of texts dropped since the previous call, because the buffer was full.
+func (s *FeedSubscription) Dropped() int64 {
+	return atomic.SwapInt64(&s.dropped, 0)
+}
+
+// Cancel unregisters the FeedSubscription from its Feed.
+func (s *FeedSubscription) Cancel() {
+	s.f.mux.Lock()
+	defer s.f.mux.Unlock()
+	if s.f.subs[s] {
+		delete(s.f.subs, s)
+		close(s.done)
+	}
+}
@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"github.com/coderafting/sentiment-analysis/internal/pipeline"
+	"testing"
+)
+
+func TestFeed(t *testing.T) {
+	f := NewFeed()
+	all := f.Subscribe(Filter{}, 10)
+	sad := f.Subscribe(Filter{Categories: []string{"sadness", "fear"}, Communities: []string{"default"}}, 1)
+	f.Publish(pipeline.TweetText{ID: "1", TextString: "I am sad", Categories: []string{"sadness"}})
+	f.Publish(pipeline.TweetText{ID: "2", TextString: "I am happy", Categories: []string{"jovility"}})
+	f.Publish(pipeline.TweetText{ID: "3", TextString: "I am sad and scared", Categories: []string{"sadness", "fear"}})
+	f.Publish(pipeline.TweetText{ID: "4", TextString: "I am sad", Categories: []string{"sadness"}, Community: "#friday"})
+	if len(all.Texts()) != 4 || all.Dropped() != 0 {
+		t.Errorf("Failed: expected %v texts and none dropped, got %v", 4, len(all.Texts()))
+	}
+	if txt := <-all.Texts(); txt.ID != "1" || txt.Community != "default" || txt.Lang != "en" {
+		t.Errorf("Failed: expected the first text in the default community and language, got %v", txt)
+	}
+	if txt := <-sad.Texts(); txt.ID != "1" {
+		t.Errorf("Failed: expected the first sad text, got %v", txt)
+	}
+	if dropped := sad.Dropped(); dropped != 1 {
+		t.Errorf("Failed: expected %v dropped text, got %v", 1, dropped)
+	}
+	if dropped := sad.Dropped(); dropped != 0 {
+		t.Errorf("Failed: expected the dropped texts to be reset, got %v", dropped)
+	}
+	sad.Cancel()
+	f.Publish(pipeline.TweetText{ID: "5", TextString: "I am sad", Categories: []string{"sadness"}})
+	if len(sad.Texts()) != 0 {
+		t.Errorf("Failed: expected no texts after Cancel, got %v", len(sad.Texts()))
+	}
+	f.Close()
+	select {
+	case <-all.Done():
+	default:
+		t.Errorf("Failed: expected the subscription to be closed")
+	}
+	select {
+	case <-f.Subscribe(Filter{}, 1).Done():
+	default:
+		t.Errorf("Failed: expected a subscription to a closed feed to be closed")
+	}
+}
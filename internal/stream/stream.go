@@ -0,0 +1,221 @@
+// Package stream broadcasts the changes of the sentiments to the subscribers of a live stream, e.g. over
+// Server-Sent Events. The recent events are kept, so that a subscriber can resume after the last event it received.
+// It also broadcasts the texts saved by the pipeline to the subscribers of a live feed, e.g. over WebSocket.
+package stream
+
+import (
+	"errors"
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrGap is returned when the events that follow the last event received by a subscriber are no longer kept,
+// e.g. because the service has been restarted since.
+var ErrGap = errors.New("the missed events are no longer available")
+
+// ErrInvalidEventID is returned when the ID of the last event received by a subscriber can not be decoded.
+var ErrInvalidEventID = errors.New("invalid event ID")
+
+// Event is the sentiment of a category right after a change, within a community, or across all the communities
+// if the Community is empty. The ID increases with every event, and the Epoch identifies the Broker that published it.
+type Event struct {
+	ID            uint64 `json:"-"`
+	Epoch         string `json:"-"`
+	Community     string `json:",omitempty"`
+	Category      string
+	Value         float64
+	TextCount     int
+	WeightedCount float64
+	TotalTexts    int
+	TotalWeight   float64
+}
+
+// Broker broadcasts the events to the subscriptions, and keeps the last events for the resumptions.
+// A Broker never blocks its publisher: the events pending for a subscription are coalesced per category,
+// so a slow subscriber only receives the latest event of every category.
+type Broker struct {
+	mux         sync.Mutex
+	epoch       string
+	seq         uint64
+	history     []Event
+	historySize int
+	subs        map[*Subscription]bool
+	closed      bool
+}
+
+// NewBroker returns a Broker that keeps the last historySize events. The epoch of the Broker is the time
+// it was created at, so that the IDs of its events are not mistaken for the IDs of a previous Broker, e.g. of
+// the process before a restart, whose counter started over.
+func NewBroker(historySize int) *Broker {
+	return &Broker{epoch: strconv.FormatInt(time.Now().UnixNano(), 36), historySize: historySize,
+		subs: map[*Subscription]bool{}}
+}
+
+// Epoch returns the epoch of the Broker, which prefixes the StreamIDs of its events.
+func (b *Broker) Epoch() string {
+	return b.epoch
+}
+
+// StreamID returns the ID of the event as sent to the subscribers, made of its Epoch and of its ID,
+// e.g. "kf3x2a1b-42". It is the lastEventID of a subscription that resumes after the event.
+func (e Event) StreamID() string {
+	return e.Epoch + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+// parseStreamID decodes a StreamID into its epoch and its ID.
+func parseStreamID(id string) (string, uint64, error) {
+	i := strings.LastIndex(id, "-")
+	if i <= 0 {
+		return "", 0, ErrInvalidEventID
+	}
+	n, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidEventID
+	}
+	return id[:i], n, nil
+}
+
+// Publish broadcasts a SentimentChange as two events, one across all the communities and one within the community
+// of the change.
+func (b *Broker) Publish(c database.SentimentChange) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	catg := string(c.Category)
+	b.publish(Event{Category: catg, Value: c.Sentiment.Value, TextCount: c.Sentiment.TextCount,
+		WeightedCount: c.Sentiment.WeightedCount, TotalTexts: c.TotalTexts, TotalWeight: c.TotalWeight})
+	b.publish(Event{Community: string(c.Community), Category: catg, Value: c.CommunitySentiment.Value,
+		TextCount: c.CommunitySentiment.TextCount, WeightedCount: c.CommunitySentiment.WeightedCount,
+		TotalTexts: c.CommunityTotalTexts, TotalWeight: c.CommunityTotalWeight})
+}
+
+// publish assigns an ID to the event, keeps it, and delivers it to the subscriptions. The caller must hold the mux.
+func (b *Broker) publish(e Event) {
+	b.seq++
+	e.ID, e.Epoch = b.seq, b.epoch
+	if b.historySize > 0 {
+		if len(b.history) == b.historySize {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, e)
+	}
+	for sub := range b.subs {
+		sub.deliver(e)
+	}
+}
+
+// Subscribe registers a subscription to the events of a community, or to the events across all the communities
+// if the community is empty. If lastEventID is not empty, it is the StreamID of the last event received by
+// the subscriber, and the kept events that follow it are delivered first. ErrGap is returned along with
+// the subscription if some of them are no longer kept, or if the event was published by another Broker,
+// the subscription then delivers the new events only. ErrInvalidEventID is returned, without a subscription,
+// if lastEventID can not be decoded.
+func (b *Broker) Subscribe(community string, lastEventID string) (*Subscription, error) {
+	var epoch string
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		if epoch, lastID, err = parseStreamID(lastEventID); err != nil {
+			return nil, err
+		}
+	}
+	sub := &Subscription{community: community, pending: map[string]Event{}, ready: make(chan struct{}, 1),
+		done: make(chan struct{}), b: b}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		close(sub.done)
+		return sub, nil
+	}
+	b.subs[sub] = true
+	if lastEventID == "" {
+		return sub, nil
+	}
+	if epoch != b.epoch {
+		return sub, ErrGap
+	}
+	if lastID == b.seq {
+		return sub, nil
+	}
+	if lastID > b.seq || len(b.history) == 0 || b.history[0].ID > lastID+1 {
+		return sub, ErrGap
+	}
+	for _, e := range b.history {
+		if e.ID > lastID {
+			sub.deliver(e)
+		}
+	}
+	return sub, nil
+}
+
+// Close closes all the subscriptions, and the subscriptions registered afterwards.
+func (b *Broker) Close() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.done)
+		delete(b.subs, sub)
+	}
+}
+
+// Subscription holds the events pending for a subscriber.
+type Subscription struct {
+	community string
+	mux       sync.Mutex
+	pending   map[string]Event
+	ready     chan struct{}
+	done      chan struct{}
+	b         *Broker
+}
+
+// deliver adds the event to the pending events, if it belongs to the community of the Subscription.
+func (s *Subscription) deliver(e Event) {
+	if e.Community != s.community {
+		return
+	}
+	s.mux.Lock()
+	s.pending[e.Category] = e
+	s.mux.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready returns a channel that receives a value when some events are pending.
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done returns a channel that is closed when the Subscription is cancelled, or when the Broker is closed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Next returns the pending events sorted by their ID, and clears them. A category appears at most once,
+// with its latest event.
+func (s *Subscription) Next() []Event {
+	s.mux.Lock()
+	events := make([]Event, 0, len(s.pending))
+	for _, e := range s.pending {
+		events = append(events, e)
+	}
+	s.pending = map[string]Event{}
+	s.mux.Unlock()
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events
+}
+
+// Cancel unregisters the Subscription from its Broker.
+func (s *Subscription) Cancel() {
+	s.b.mux.Lock()
+	defer s.b.mux.Unlock()
+	if s.b.subs[s] {
+		delete(s.b.subs, s)
+		close(s.done)
+	}
+}
@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"github.com/coderafting/sentiment-analysis/internal/database"
+	"reflect"
+	"testing"
+)
+
+func change(comm string, catg string, count int, total int) database.SentimentChange {
+	sent := database.Sentiment{Value: float64(count) / float64(total), TextCount: count, WeightedCount: float64(count)}
+	return database.SentimentChange{Community: database.Community(comm), Category: database.Category(catg),
+		Sentiment: sent, TotalTexts: total, CommunitySentiment: sent, CommunityTotalTexts: total}
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(4)
+	all, _ := b.Subscribe("", "")
+	cats, _ := b.Subscribe("cats", "")
+	b.Publish(change("cats", "jovility", 1, 1))
+	b.Publish(change("dogs", "sadness", 1, 2))
+	b.Publish(change("cats", "jovility", 2, 3))
+	select {
+	case <-all.Ready():
+	default:
+		t.Errorf("Failed: expected pending events")
+	}
+	expected := []Event{
+		Event{ID: 3, Epoch: b.Epoch(), Category: "sadness", Value: 0.5, TextCount: 1, WeightedCount: 1, TotalTexts: 2},
+		Event{ID: 5, Epoch: b.Epoch(), Category: "jovility", Value: 2.0 / 3, TextCount: 2, WeightedCount: 2,
+			TotalTexts: 3},
+	}
+	if out := all.Next(); !reflect.DeepEqual(out, expected) {
+		t.Errorf("Failed: expected the coalesced events %v, got %v", expected, out)
+	}
+	if out := cats.Next(); len(out) != 1 || out[0].ID != 6 || out[0].Community != "cats" {
+		t.Errorf("Failed: expected the latest event of cats, got %v", out)
+	}
+	if out := all.Next(); len(out) != 0 {
+		t.Errorf("Failed: expected no pending events, got %v", out)
+	}
+	all.Cancel()
+	select {
+	case <-all.Done():
+	default:
+		t.Errorf("Failed: expected a cancelled subscription to be done")
+	}
+}
+
+func TestBrokerResume(t *testing.T) {
+	b := NewBroker(4)
+	for i := 1; i <= 3; i++ {
+		b.Publish(change("cats", "jovility", i, i))
+	}
+	epoch := b.Epoch()
+	type testCase struct {
+		lastID   string
+		err      error
+		expected []uint64
+	}
+	cases := []testCase{
+		testCase{lastID: epoch + "-3", expected: []uint64{5}},
+		testCase{lastID: epoch + "-5", expected: []uint64{}},
+		testCase{lastID: epoch + "-6", expected: []uint64{}},
+		testCase{lastID: epoch + "-1", err: ErrGap, expected: []uint64{}},
+		testCase{lastID: epoch + "-42", err: ErrGap, expected: []uint64{}},
+		// The IDs of a previous process are gaps even if the ID is kept.
+		testCase{lastID: "kf3x2a1b-3", err: ErrGap, expected: []uint64{}},
+	}
+	for _, c := range cases {
+		sub, err := b.Subscribe("", c.lastID)
+		ids := []uint64{}
+		for _, e := range sub.Next() {
+			ids = append(ids, e.ID)
+		}
+		if err != c.err || !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("Failed for %v: expected %v, %v, got %v, %v", c.lastID, c.expected, c.err, ids, err)
+		}
+		sub.Cancel()
+	}
+	for _, id := range []string{"last", "3", "-3", epoch + "-", epoch + "-x"} {
+		if sub, err := b.Subscribe("", id); sub != nil || err != ErrInvalidEventID {
+			t.Errorf("Failed for %v: expected %v, got %v", id, ErrInvalidEventID, err)
+		}
+	}
+	sub, _ := b.Subscribe("", "")
+	b.Close()
+	select {
+	case <-sub.Done():
+	default:
+		t.Errorf("Failed: expected the subscriptions to be done once the broker is closed")
+	}
+	sub.Cancel()
+}
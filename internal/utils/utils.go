@@ -29,3 +29,52 @@ func JSONErrorResponse(w http.ResponseWriter, err string) {
 	re := render.New()
 	re.JSON(w, http.StatusBadRequest, err)
 }
+
+// JSONTooManyRequestsResponse creates an http response object for a request that was rejected due to the load.
+func JSONTooManyRequestsResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusTooManyRequests, err)
+}
+
+// JSONUnavailableResponse creates an http response object for a request that can not be served at the moment.
+func JSONUnavailableResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusServiceUnavailable, err)
+}
+
+// JSONUnavailableDataResponse creates an http response object for a request that can not be served at the moment,
+// with a data body that explains why.
+func JSONUnavailableDataResponse(w http.ResponseWriter, data interface{}) {
+	re := render.New()
+	re.JSON(w, http.StatusServiceUnavailable, data)
+}
+
+// JSONTooLargeResponse creates an http response object for a request whose body is too large.
+func JSONTooLargeResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusRequestEntityTooLarge, err)
+}
+
+// JSONUnauthorizedResponse creates an http response object for a request that lacks valid credentials.
+func JSONUnauthorizedResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusUnauthorized, err)
+}
+
+// JSONForbiddenResponse creates an http response object for a request that is not allowed.
+func JSONForbiddenResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusForbidden, err)
+}
+
+// JSONNotFoundResponse creates an http not-found response object.
+func JSONNotFoundResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusNotFound, err)
+}
+
+// JSONInternalErrorResponse creates an http response object for a request that failed on the server side.
+func JSONInternalErrorResponse(w http.ResponseWriter, err string) {
+	re := render.New()
+	re.JSON(w, http.StatusInternalServerError, err)
+}